@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// ArticleSort is a field articles can be ordered by
+type ArticleSort string
+
+// Fields articles can be ordered by
+const (
+	SortByCreatedAt  ArticleSort = "created_at"
+	SortByModifiedAt ArticleSort = "modified_at"
+	SortByTitle      ArticleSort = "title"
+)
+
+// ArticleQuery describes a page of articles requested from an ArticleStore.
+// Articles are ordered by Sort, with the ID breaking ties, so that pages are stable.
+type ArticleQuery struct {
+	// Limit is the maximum number of articles on the page
+	Limit      int
+	Sort       ArticleSort
+	Descending bool
+	// Status is the status of every listed article, or empty to list articles of every status
+	Status ArticleStatus
+	// Trashed lists the articles inside the trash instead of the articles outside of it
+	Trashed bool
+	// AuthorID restricts the listed articles to a single author, when set
+	AuthorID string
+	// CreatedAfter and CreatedBefore exclusively bound the creation time of the articles, when set
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// After is the position of the last article of the previous page, or nil for the first page
+	After *ArticleCursor
+}
+
+// ArticleCursor is the position of an article in the order of an ArticleQuery
+type ArticleCursor struct {
+	Sort       ArticleSort `json:"sort"`
+	Descending bool        `json:"desc,omitempty"`
+	// Time is the value of the sort field when sorting by created_at or modified_at
+	Time time.Time `json:"time"`
+	// Title is the value of the sort field when sorting by title
+	Title string `json:"title,omitempty"`
+	ID    string `json:"id"`
+}
+
+// ArticleList holds a page of articles decoded from a store, along with the stored documents which could not be decoded
+type ArticleList struct {
+	Articles []*Article
+	Invalid  []*DocumentError
+	// NextCursor is the position to continue after, or nil on the last page
+	NextCursor *ArticleCursor
+}
+
+// cursorFor returns the position of article in the order of the query
+func (query ArticleQuery) cursorFor(article *Article) *ArticleCursor {
+	cursor := &ArticleCursor{Sort: query.Sort, Descending: query.Descending, ID: article.ID}
+	switch query.Sort {
+	case SortByTitle:
+		cursor.Title = article.Title
+	case SortByModifiedAt:
+		cursor.Time = article.modifiedOrCreatedAt()
+	default:
+		cursor.Time = article.CreatedAt
+	}
+	return cursor
+}
+
+// value returns the value of the sort field held by the cursor
+func (cursor *ArticleCursor) value() interface{} {
+	if cursor.Sort == SortByTitle {
+		return cursor.Title
+	}
+	return cursor.Time
+}
+
+// compare orders two cursors of the same query, returning a negative number when a comes first
+func (query ArticleQuery) compare(a, b *ArticleCursor) int {
+	result := 0
+	switch {
+	case query.Sort == SortByTitle:
+		result = strings.Compare(a.Title, b.Title)
+	case a.Time.Before(b.Time):
+		result = -1
+	case a.Time.After(b.Time):
+		result = 1
+	}
+	if result == 0 {
+		result = strings.Compare(a.ID, b.ID)
+	}
+	if query.Descending {
+		return -result
+	}
+	return result
+}
+
+// matches reports whether article passes the filters of the query and comes after its cursor
+func (query ArticleQuery) matches(article *Article) bool {
+	if query.Status != "" && article.Status != query.Status {
+		return false
+	}
+	if (article.DeletedAt != nil) != query.Trashed {
+		return false
+	}
+	if query.AuthorID != "" && article.AuthorID != query.AuthorID {
+		return false
+	}
+	if query.CreatedAfter != nil && !article.CreatedAt.After(*query.CreatedAfter) {
+		return false
+	}
+	if query.CreatedBefore != nil && !article.CreatedAt.Before(*query.CreatedBefore) {
+		return false
+	}
+	return query.After == nil || query.compare(query.cursorFor(article), query.After) > 0
+}
+
+// isFull reports whether the list holds more articles than fit on the page, so the store can stop reading
+func (list *ArticleList) isFull(query ArticleQuery) bool {
+	return len(list.Articles) > query.Limit
+}
+
+// finishPage trims the article read past the limit and sets NextCursor when there is such an article
+func (list *ArticleList) finishPage(query ArticleQuery) {
+	if !list.isFull(query) {
+		return
+	}
+	list.Articles = list.Articles[:query.Limit]
+	list.NextCursor = query.cursorFor(list.Articles[query.Limit-1])
+}
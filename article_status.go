@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ArticleStatus is the stage of the lifecycle an article is in
+type ArticleStatus string
+
+// Stages of the lifecycle of an article
+const (
+	// StatusDraft articles are only visible to their author, editors and admins
+	StatusDraft ArticleStatus = "draft"
+	// StatusPublished articles are visible to everyone
+	StatusPublished ArticleStatus = "published"
+	// StatusArchived articles were taken down and are only visible to their author, editors and admins
+	StatusArchived ArticleStatus = "archived"
+)
+
+// ErrArticleStatusUnchanged is returned when an article is moved to the status it already has
+var ErrArticleStatusUnchanged = errors.New("the article already has this status")
+
+// isValid reports whether status is one of the known statuses
+func (status ArticleStatus) isValid() bool {
+	switch status {
+	case StatusDraft, StatusPublished, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// setStatus moves the article to status at given time, which cancels its scheduled publication. published_at records
+// when it was first published, and is cleared when it is unpublished back into a draft.
+func (article *Article) setStatus(status ArticleStatus, now time.Time) error {
+	if article.Status == status {
+		return ErrArticleStatusUnchanged
+	}
+	switch status {
+	case StatusPublished:
+		if article.PublishedAt == nil {
+			article.PublishedAt = &now
+		}
+	case StatusDraft:
+		article.PublishedAt = nil
+	}
+	article.Status = status
+	article.PublishAt = nil
+	article.ModifiedAt = &now
+	return nil
+}
+
+// ChangeArticleStatusByID moves an existing article by ID to status, if identity is its author, an editor or an admin
+func (blogs *Blogs) ChangeArticleStatusByID(identity *Identity, ID string, status ArticleStatus) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
+			return err
+		}
+		return article.setStatus(status, time.Now().UTC())
+	})
+}
@@ -8,16 +8,19 @@ import (
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Users is a structure which holds database for CRUD operation in the client and app initialized for admin in the backend
+// Users is a structure which holds user store for CRUD operation in the client and app initialized for admin in the backend.
+// authClient is nil unless users are stored inside Firebase.
 type Users struct {
-	db         *firestore.Client
-	authClient *auth.Client
+	store           UserStore
+	tokens          TokenStore
+	authClient      AuthClient
+	keys            *KeySet
+	refreshTokenTTL time.Duration
 }
 
 // User holds basic user info of a current user
@@ -25,20 +28,50 @@ type User struct {
 	GeneratedID string `json:"id"`
 	Email       string `json:"email"`
 	Password    string `json:"password"`
+	Role        Role   `json:"role"`
 }
 
-func initUsers(db *firestore.Client, authClient *auth.Client) *Users {
-	return &Users{db: db, authClient: authClient}
+// minPasswordLength is the shortest password Firebase Authentication accepts, which every storage backend enforces alike
+const minPasswordLength = 6
+
+// isValidEmail reports whether email has a single "@" between a local part and a domain, as Firebase Authentication requires
+func isValidEmail(email string) bool {
+	parts := strings.Split(email, "@")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// isWeakPasswordError reports whether Firebase Authentication rejected a password as too weak,
+// which the Admin SDK has no error code for
+func isWeakPasswordError(err error) bool {
+	return auth.IsUnknown(err) && strings.Contains(err.Error(), "WEAK_PASSWORD")
+}
+
+// effectiveRole returns the stored role of the user, unless ADMIN_EMAILS makes them an admin
+func (user *User) effectiveRole() Role {
+	if isAdminEmail(user.Email) {
+		return RoleAdmin
+	}
+	return user.Role
+}
+
+func initUsers(store UserStore, tokens TokenStore, authClient AuthClient, keys *KeySet, refreshTokenTTL time.Duration) *Users {
+	return &Users{store: store, tokens: tokens, authClient: authClient, keys: keys, refreshTokenTTL: refreshTokenTTL}
 }
 
-func createTokenForAuth(email string) (string, error) {
-	jwtHashKey := env.JwtHashKey
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_email": email,
+// createTokenForAuth mints an access token of user, identified by a random jti so that it can be revoked.
+// sessionID is the refresh token family the token belongs to, which is revoked along with it on logout.
+func (users *Users) createTokenForAuth(user *User, sessionID string) (string, error) {
+	now := time.Now()
+	tokenString, err := users.keys.sign(jwt.MapClaims{
+		"jti":        newAutoID(),
+		"sid":        sessionID,
+		"user_id":    user.GeneratedID,
+		"user_email": user.Email,
+		"role":       string(user.effectiveRole()),
 		"iss":        "__init__",
-		"exp":        time.Now().Add(time.Minute * 60).Unix(),
+		"iat":        now.Unix(),
+		"exp":        now.Add(accessTokenTTL).Unix(),
 	})
-	tokenString, err := token.SignedString([]byte(jwtHashKey))
 	log.Println(tokenString) // <--- security problem
 	if err != nil {
 		return "", err
@@ -46,114 +79,156 @@ func createTokenForAuth(email string) (string, error) {
 	return tokenString, nil
 }
 
-// Signup registers a new user with given valid email and password
+// Signup registers a new user with given valid email and password.
+// When users are stored inside Firebase, the auth user is deleted again if the user cannot be stored.
 func (users *Users) Signup(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
-
-	if request.Method != http.MethodPost {
-		statusCode := http.StatusMethodNotAllowed
-		statusMessage := Error{
-			Message: http.StatusText(statusCode),
-		}
-		ExitWithError(response, statusCode, statusMessage)
+	input, err := decodeInput(request, "email", "password")
+	if err != nil {
+		exitWithInputError(response, err)
 		return
 	}
-
-	request.ParseForm()
-	urlEncodedFormInputMap := request.Form
-	email, isEmailFound := urlEncodedFormInputMap["email"]
-	password, isPasswordFound := urlEncodedFormInputMap["password"]
+	email, isEmailFound := input["email"]
+	password, isPasswordFound := input["password"]
 
 	if isEmailFound == false {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Email is required.",
+			Code:   CodeValidationFailed,
+			Detail: "Email is required.",
+			Errors: []FieldError{{Field: "email", Reason: "is required"}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
 	if isPasswordFound == false {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Password is required.",
+			Code:   CodeValidationFailed,
+			Detail: "Password is required.",
+			Errors: []FieldError{{Field: "password", Reason: "is required"}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	params := (&auth.UserToCreate{}).
-		Email(strings.Join(email, "")).
-		Password(strings.Join(password, "")).
-		Disabled(false)
+	// every storage backend compares emails case insensitively, new users are stored with their email in lower case
+	emailAddress := strings.ToLower(email[0])
+	if !isValidEmail(emailAddress) {
+		statusMessage := Error{
+			Code:   CodeValidationFailed,
+			Detail: "Email is not a valid email address.",
+			Errors: []FieldError{{Field: "email", Reason: "is not a valid email address"}},
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
 
-	newUser, err := users.authClient.CreateUser(context.Background(), params)
-	if err != nil {
-		statusCode := http.StatusServiceUnavailable
+	if len(password[0]) < minPasswordLength {
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message:       err.Error(),
-			CustomMessage: "Error creating a user.",
+			Code:   CodeValidationFailed,
+			Detail: fmt.Sprintf("Password must be at least %d characters long.", minPasswordLength),
+			Errors: []FieldError{{Field: "password", Reason: fmt.Sprintf("must be at least %d characters long", minPasswordLength)}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
-	log.Printf("Successfully created user: %#v\n", newUser.UserInfo)
 
+	// the password is hashed before the auth user is created, leaving storing the user as the only step which can fail after it
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password[0]), 10)
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
 		statusMessage := Error{
-			Message:       err.Error(),
-			CustomMessage: "Error minting a token.",
+			Code:   CodeInternalError,
+			Detail: "Error hashing the password.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
+
+	generatedID := newAutoID()
+	if users.authClient != nil {
+		params := (&auth.UserToCreate{}).
+			Email(emailAddress).
+			Password(strings.Join(password, "")).
+			Disabled(false)
+
+		newUser, err := users.authClient.CreateUser(context.Background(), params)
+		if auth.IsEmailAlreadyExists(err) {
+			statusMessage := Error{
+				Code:   CodeUserAlreadyExists,
+				Detail: "A user with this email already exists.",
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if auth.IsInvalidEmail(err) {
+			statusMessage := Error{
+				Code:   CodeValidationFailed,
+				Detail: "Email is not a valid email address.",
+				Errors: []FieldError{{Field: "email", Reason: "is not a valid email address"}},
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if isWeakPasswordError(err) {
+			statusMessage := Error{
+				Code:   CodeValidationFailed,
+				Detail: "Password is too weak.",
+				Errors: []FieldError{{Field: "password", Reason: "is too weak"}},
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+		log.Printf("Successfully created user: %#v\n", newUser.UserInfo)
+		generatedID = newUser.UID
+
+		// the "reconcile" subcommand only deletes auth users without a user document when they are marked as signed up here
+		err = users.authClient.SetCustomUserClaims(context.Background(), generatedID, map[string]interface{}{signupClaim: true})
+		if err != nil {
+			if deleteErr := users.authClient.DeleteUser(context.Background(), generatedID); deleteErr != nil {
+				log.Printf("error deleting auth user %s after failing to mark it, delete it by hand: %v\n", generatedID, deleteErr)
+			}
+			exitWithStoreError(response, err)
+			return
+		}
+	}
+
 	log.Println(password[0])
 	log.Println(hashedPassword)
 	newUserInfo := User{
-		GeneratedID: newUser.UID,
-		Email:       email[0],
+		GeneratedID: generatedID,
+		Email:       emailAddress,
 		Password:    string(hashedPassword),
+		Role:        defaultRole,
 	}
 	log.Println(newUserInfo)
-	docRef, _, err := users.db.Collection("users").Add(context.Background(), map[string]interface{}{
-		"id":       newUserInfo.GeneratedID,
-		"email":    newUserInfo.Email,
-		"password": newUserInfo.Password,
-	})
-
-	if err != nil {
-		statusCode := http.StatusServiceUnavailable
+	err = users.store.AddUser(context.Background(), &newUserInfo)
+	if err != nil && users.authClient != nil {
+		// the auth user would be left without a user document otherwise, and its email could never sign up again
+		if deleteErr := users.authClient.DeleteUser(context.Background(), generatedID); deleteErr != nil {
+			log.Printf("error deleting auth user %s after failing to store it, run the \"reconcile repair\" subcommand: %v\n", generatedID, deleteErr)
+		}
+	}
+	if err == ErrUserAlreadyExists {
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeUserAlreadyExists,
+			Detail: "A user with this email already exists.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
-
-	docSnapshot, err := users.db.Collection("users").Doc(docRef.ID).Get(context.Background())
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
-		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
-		}
-		ExitWithError(response, statusCode, statusMessage)
+		exitWithStoreError(response, err)
 		return
 	}
 
-	docSnapshotDatum := docSnapshot.Data()
-	userEmailFromDB := docSnapshotDatum["email"].(string)
-	customMessage := fmt.Sprintf("New user was created with this email: %s", userEmailFromDB)
+	customMessage := fmt.Sprintf("New user was created with this email: %s", newUserInfo.Email)
 
 	statusCode := http.StatusCreated
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), customMessage)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := Envelope{Data: customMessage}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
 /*
@@ -166,131 +241,83 @@ func (users *Users) Signup(response http.ResponseWriter, request *http.Request)
  - create JWT token											<- adapter layer
  - return error as HTTP response (token, token missing)		<- adapter layer
 */
-// Login authenticates existing user and mints token to allow exploring other endpoints
+// Login authenticates existing user and mints token to allow exploring other endpoints,
+// along with a refresh token starting a new token family
 func (users *Users) Login(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
-
-	if request.Method != http.MethodPost {
-		statusCode := http.StatusMethodNotAllowed
-		statusMessage := Error{
-			Message: http.StatusText(statusCode),
-		}
-		ExitWithError(response, statusCode, statusMessage)
+	input, err := decodeInput(request, "email", "password")
+	if err != nil {
+		exitWithInputError(response, err)
 		return
 	}
-
-	request.ParseForm()
-	urlEncodedFormInputMap := request.Form
-	email, isEmailFound := urlEncodedFormInputMap["email"]
-	password, isPasswordFound := urlEncodedFormInputMap["password"]
+	email, isEmailFound := input["email"]
+	password, isPasswordFound := input["password"]
 
 	if isEmailFound == false {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Email is required.",
+			Code:   CodeValidationFailed,
+			Detail: "Email is required.",
+			Errors: []FieldError{{Field: "email", Reason: "is required"}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
 	if isPasswordFound == false {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Password is required.",
+			Code:   CodeValidationFailed,
+			Detail: "Password is required.",
+			Errors: []FieldError{{Field: "password", Reason: "is required"}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	// inject dependencies
-	func initLoginUseCase(db *firestore.Client) *LoginUseCase { // <-- usually happens at application startup
-		return &LoginUseCase{ persistence: &UserPersistenceWithFirebase{db: db} }
-	}
-
-	// 2 other objects
-	// 1. business logic (struct type, which only depends on persistence obj. Conforms to the obj `UserlookUpper`.)
-	// 2. persistence object
-
-	type UserPersistence interface { // <-- like input port or output port
-		LookupByEmail(email string) user
-	}
-
-	type UserPersistenceWithFirebase struct { // <--- presenter
-		db *firestore.Client
-	}
-
-	// interactor (domain)
-	type LoginUseCase struct {
-		persistence *UserPersistence
-	}
-
-	func (useCase *LoginUseCase) loginUser(email, password) user, error {
-		user, err := useCase.persistence.LookupByEmail(email)
-		if err != nil {
-			return // return new business domain error UserNotFoundException
-		}
-
-		// we check if password is correct
-
-		if err != nil {
-			return // return new business domain error InvalidPassword
-		}
-	}
-
-	token, err := useCase.LoginUser(email, passowrd)
-	iter := users.db.Collection("users").Where("email", "==", strings.Join(email, "")).Limit(1).Documents(context.Background())
-	doc, err := iter.GetAll()
-	if err != nil {
-		statusCode := http.StatusServiceUnavailable
+	userFromDB, err := users.store.GetUserByEmail(context.Background(), strings.ToLower(strings.Join(email, "")))
+	if err == ErrUserNotFound {
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeLoginFailed,
+			Detail: "Login failed. Make sure both of your email and password is correct.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
-
-	if len(doc) == 0 {
-		statusCode := http.StatusBadRequest
-		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Login failed. The user does not exist.",
-		}
-		ExitWithError(response, statusCode, statusMessage)
+	if err != nil {
+		exitWithStoreError(response, err)
 		return
 	}
 
-	userInfoFromDB := doc[0].Data()
-	hashedPassword := userInfoFromDB["password"]
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword.(string)), []byte(password[0]))
+	hashedPassword := userFromDB.Password
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password[0]))
 	log.Println(hashedPassword) 	// <--- security problem	
 	log.Println(password[0])		// <--- security problem
 	if err != nil {
-		statusCode := http.StatusUnauthorized
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Login failed. Make sure both of your email and password is correct.",
+			Code:   CodeLoginFailed,
+			Detail: "Login failed. Make sure both of your email and password is correct.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	token, err := createTokenForAuth(email[0])
+	sessionID := newAutoID()
+	token, err := users.createTokenForAuth(userFromDB, sessionID)
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Failed to mint a token",
+			Code:   CodeInternalError,
+			Detail: "Failed to mint a token",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
+		return
+	}
+	refreshToken, err := users.issueRefreshToken(context.Background(), userFromDB.GeneratedID, sessionID)
+	if err != nil {
+		exitWithStoreError(response, err)
 		return
 	}
 
 	statusCode := http.StatusOK
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), token)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := Envelope{Data: newTokenPair(token, refreshToken)}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
 /*
@@ -303,37 +330,104 @@ func (users *Users) Login(response http.ResponseWriter, request *http.Request) {
 */
 func (users *Users) verifyToken(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		response.Header().Set("Content-Type", "application/json")
 		authHeader := request.Header.Get("Authorization")
 		bearerToken := strings.Split(authHeader, " ")
 
 		if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
 			tokenFromClient := bearerToken[1]
-			token, err := jwt.Parse(tokenFromClient, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("Error occured")
-				}
-				jwtHashKey := LoadEnvFileAndReturnEnvVarValueByKey("JWT_HASH_KEY")
-				return []byte(jwtHashKey), nil
-			})
+			var identity *Identity
+			if users.authClient != nil && isFirebaseIDToken(tokenFromClient) {
+				identity = users.verifyFirebaseIDToken(response, request, tokenFromClient)
+			} else {
+				identity = users.verifyLocalToken(response, tokenFromClient)
+			}
+			if identity == nil {
+				return
+			}
 
-			if err != nil || !token.Valid {
+			revoked, err := users.tokens.IsAccessTokenRevoked(request.Context(), identity.revocationIDs(), identity.UserID, identity.TokenIssuedAt)
+			if err != nil {
+				exitWithStoreError(response, err)
+				return
+			}
+			if revoked {
 				statusMessage := Error{
-					Message:       http.StatusText(http.StatusUnauthorized),
-					CustomMessage: "Auth Failed.",
+					Code:   CodeAuthTokenRevoked,
+					Detail: "Auth Failed. The token was revoked, please log in again.",
 				}
-				ExitWithError(response, statusCode, statusMessage)
+				ExitWithError(response, statusMessage)
 				return
 			}
 
-			next.ServeHTTP(response, request)
+			next.ServeHTTP(response, request.WithContext(withIdentity(request.Context(), identity)))
 		} else {
 			statusMessage := Error{
-				Message:       http.StatusText(http.StatusBadRequest),
-				CustomMessage: "Invalid Token.",
+				Code:   CodeAuthTokenMissing,
+				Detail: "Invalid Token. Send it inside the Authorization header as Bearer <token>.",
 			}
-			ExitWithError(response, statusCode, statusMessage)
+			ExitWithError(response, statusMessage)
 			return
 		}
 	})
 }
+
+// verifyLocalToken returns the identity of a token minted by Login or RefreshTokenHandler,
+// or responds with the reason the token is rejected and returns nil
+func (users *Users) verifyLocalToken(response http.ResponseWriter, tokenFromClient string) *Identity {
+	token, err := jwt.Parse(tokenFromClient, users.keys.verificationKey)
+
+	// an expired token is told apart from a forged one, so that clients know to log in again
+	if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors == jwt.ValidationErrorExpired {
+		statusMessage := Error{
+			Code:   CodeAuthTokenExpired,
+			Detail: "Auth Failed. The token has expired, please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+	if err != nil || !token.Valid {
+		statusMessage := Error{
+			Code:   CodeAuthTokenInvalid,
+			Detail: "Auth Failed.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	userID, _ := claims["user_id"].(string)
+	email, _ := claims["user_email"].(string)
+	role, _ := claims["role"].(string)
+	if userID == "" || email == "" || !Role(role).isValid() {
+		statusMessage := Error{
+			Code:   CodeAuthTokenInvalid,
+			Detail: "Auth Failed. The token does not identify a user, please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+
+	// tokens minted before they carried a jti cannot be revoked, so they are not accepted either
+	tokenID, _ := claims["jti"].(string)
+	sessionID, _ := claims["sid"].(string)
+	issuedAt, hasIssuedAt := claims["iat"].(float64)
+	expiresAt, hasExpiresAt := claims["exp"].(float64)
+	if tokenID == "" || !hasIssuedAt || !hasExpiresAt {
+		statusMessage := Error{
+			Code:   CodeAuthTokenInvalid,
+			Detail: "Auth Failed. The token cannot be revoked, please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+
+	return &Identity{
+		UserID:         userID,
+		Email:          email,
+		Role:           Role(role),
+		TokenID:        tokenID,
+		SessionID:      sessionID,
+		TokenIssuedAt:  time.Unix(int64(issuedAt), 0).UTC(),
+		TokenExpiresAt: time.Unix(int64(expiresAt), 0).UTC(),
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestSignupValidatesCredentials(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		for _, test := range []struct {
+			email, password, field string
+		}{
+			{"not-an-email", testPassword, "email"},
+			{"two@at@example.com", testPassword, "email"},
+			{"short@example.com", "12345", "password"},
+		} {
+			credentials := map[string]string{"email": test.email, "password": test.password}
+			recorder := server.do(http.MethodPost, "/v1/users", "", credentials)
+			expectProblem(t, recorder, http.StatusBadRequest, CodeValidationFailed)
+			var problem Error
+			json.Unmarshal(recorder.Body.Bytes(), &problem)
+			if len(problem.Errors) != 1 || problem.Errors[0].Field != test.field {
+				t.Errorf("signing up %q with %q: expected an error about %s, got %+v", test.email, test.password, test.field, problem.Errors)
+			}
+		}
+
+		server.login("user@example.com")
+		credentials := map[string]string{"email": "user@example.com", "password": testPassword}
+		recorder := server.do(http.MethodPost, "/v1/users", "", credentials)
+		expectProblem(t, recorder, http.StatusConflict, CodeUserAlreadyExists)
+	})
+}
+
+func TestEmailsAreCaseInsensitive(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		credentials := map[string]string{"email": "Author@Example.com", "password": testPassword}
+		expectStatus(t, server.do(http.MethodPost, "/v1/users", "", credentials), http.StatusCreated)
+		credentials["email"] = "author@example.com"
+		expectProblem(t, server.do(http.MethodPost, "/v1/users", "", credentials), http.StatusConflict, CodeUserAlreadyExists)
+
+		credentials["email"] = "AUTHOR@example.COM"
+		expectStatus(t, server.do(http.MethodPost, "/v1/sessions", "", credentials), http.StatusOK)
+		user, err := server.users.store.GetUserByEmail(context.Background(), "author@EXAMPLE.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "author@example.com" {
+			t.Fatalf("expected the email to be stored in lower case, got %q", user.Email)
+		}
+	})
+}
@@ -2,103 +2,140 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
 )
 
-func (blogs *Blogs) getAllArticles() ([]*Article, error) {
-	var articles []*Article
+// ErrNotArticleAuthor is returned when someone other than the author of an article, an editor or an admin tries to modify it
+var ErrNotArticleAuthor = errors.New("only the author of an article, an editor or an admin can modify it")
 
-	docSnapshotIter := blogs.db.Collection("blogs").Documents(context.Background())
-	for {
-		doc, err := docSnapshotIter.Next()
-		if err == iterator.Done {
-			break
+// checkCanModify returns a check for ArticleStore.Delete and ArticleStore.Update which rejects anyone but the author, editors and admins.
+// Articles inside the trash can only be restored, so they are reported as missing.
+func checkCanModify(identity *Identity) func(article *Article) error {
+	return func(article *Article) error {
+		if article.DeletedAt != nil {
+			return ErrArticleNotFound
 		}
-		if err != nil {
-			return nil, err
+		if !identity.canModify(article) {
+			return ErrNotArticleAuthor
 		}
+		return nil
+	}
+}
 
-		docSnapshotDatum := doc.Data()
+// modifiedOrCreatedAt returns when the article was last modified, which is its creation time until it is updated
+func (article *Article) modifiedOrCreatedAt() time.Time {
+	if article.ModifiedAt != nil {
+		return *article.ModifiedAt
+	}
+	return article.CreatedAt
+}
 
-		optionalModifiedField := docSnapshotDatum["modified_at"]
-		var ModifiedField string
-		if optionalModifiedField != nil {
-			ModifiedField = docSnapshotDatum["modified_at"].(string)
-		} else {
-			ModifiedField = ""
+// listArticles lists a page of articles visible to identity, who only sees their own articles unless they are published
+// and not inside the trash, or identity is an editor or an admin
+func (blogs *Blogs) listArticles(identity *Identity, query ArticleQuery) (*ArticleList, error) {
+	if (query.Status != StatusPublished || query.Trashed) && !identity.seesEveryAuthor() {
+		if identity == nil {
+			return &ArticleList{}, nil
 		}
+		query.AuthorID = identity.UserID
+	}
+	return blogs.store.List(context.Background(), query)
+}
 
-		article := Article{
-			ID:         doc.Ref.ID,
-			Title:      docSnapshotDatum["title"].(string),
-			Content:    docSnapshotDatum["content"].(string),
-			CreatedAt:  docSnapshotDatum["created_at"].(string),
-			ModifiedAt: ModifiedField,
-		}
-		articles = append(articles, &article)
+// sameTime reports whether two optional timestamps are both missing or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-	return articles, nil
+	return a.Equal(*b)
+}
+
+// isUnchangedFrom reports whether an update left every field of the article as it was before, so stores can skip writing it
+func (article *Article) isUnchangedFrom(before *Article) bool {
+	return article.AuthorID == before.AuthorID &&
+		article.Title == before.Title &&
+		article.Content == before.Content &&
+		article.Status == before.Status &&
+		article.CreatedAt.Equal(before.CreatedAt) &&
+		sameTime(article.ModifiedAt, before.ModifiedAt) &&
+		sameTime(article.PublishedAt, before.PublishedAt) &&
+		sameTime(article.PublishAt, before.PublishAt) &&
+		sameTime(article.DeletedAt, before.DeletedAt)
 }
 
-// GetArticleByID gets existing article from the DB by given ID
+// GetArticleByID gets existing article from the DB by given ID, articles inside the trash are reported as missing
 func (blogs *Blogs) GetArticleByID(ID string) (*Article, error) {
-	docSnapshot, err := blogs.db.Collection("blogs").Doc(ID).Get(context.Background())
+	article, err := blogs.store.Get(context.Background(), ID)
 	if err != nil {
 		return nil, err
 	}
-	docSnapshotDatum := docSnapshot.Data()
-
-	optionalField := docSnapshotDatum["modified_at"]
-	var modifiedTimeSlot string
-	if optionalField != nil {
-		modifiedTimeSlot = docSnapshotDatum["modified_at"].(string)
-	} else {
-		modifiedTimeSlot = ""
+	if article.DeletedAt != nil {
+		return nil, ErrArticleNotFound
 	}
+	return article, nil
+}
 
-	article := Article{
-		ID:         docSnapshot.Ref.ID,
-		Title:      docSnapshotDatum["title"].(string),
-		Content:    docSnapshotDatum["content"].(string),
-		CreatedAt:  docSnapshotDatum["created_at"].(string),
-		ModifiedAt: modifiedTimeSlot,
+// AddArticle adds a new article written by author to the DB with given title, content and status and returns its ID.
+// A draft is scheduled to be published at publishAt, when set.
+func (blogs *Blogs) AddArticle(author *Identity, title, content string, status ArticleStatus, publishAt *time.Time) (string, error) {
+	now := time.Now().UTC()
+	if publishAt != nil {
+		if status != StatusDraft {
+			return "", ErrArticleNotDraft
+		}
+		if !publishAt.After(now) {
+			return "", ErrPublishAtInPast
+		}
+	}
+	article := &Article{
+		AuthorID:   author.UserID,
+		Title:      title,
+		Content:    content,
+		Status:     status,
+		Version:    1,
+		CreatedAt:  now,
+		ModifiedAt: &now,
+		PublishAt:  publishAt,
+	}
+	if status == StatusPublished {
+		article.PublishedAt = &now
 	}
-	return &article, nil
+	return blogs.store.Add(context.Background(), article)
 }
 
-// AddArticle adds a new article to the DB with given title and content
-func (blogs *Blogs) AddArticle(title, content string) (*firestore.DocumentRef, *firestore.WriteResult, error) {
-	result, _, err := blogs.db.Collection("blogs").Add(context.Background(), map[string]interface{}{
-		"title":      title,
-		"content":    content,
-		"created_at": time.Now().String(),
+// DeleteArticleByID moves an existing article by ID to the trash, if identity is its author, an editor or an admin
+// and ifMatch lists its current version. It is permanently deleted by the trash purger once the retention period passed.
+func (blogs *Blogs) DeleteArticleByID(identity *Identity, ID, ifMatch string) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
+			return err
+		}
+		if err := checkIfMatch(ifMatch)(article); err != nil {
+			return err
+		}
+		deletedAt := time.Now().UTC()
+		article.DeletedAt = &deletedAt
+		// a trashed draft must not be published by the publish scheduler
+		article.PublishAt = nil
+		return nil
 	})
-	return result, nil, err
-}
-
-// DeleteArticleByID deletes an existing article by ID
-func (blogs *Blogs) DeleteArticleByID(ID string) (*firestore.DocumentSnapshot, error) {
-	_, err := blogs.db.Collection("blogs").Doc(ID).Delete(context.Background())
-	return nil, err
 }
 
-// UpdateArticleByID updates an existing article by ID
-func (blogs *Blogs) UpdateArticleByID(ID, title, content string) error {
-	ref := blogs.db.Collection("blogs").Doc(ID)
-	err := blogs.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
-		_, err := tx.Get(ref)
-		if err != nil {
+// UpdateArticleByID updates an existing article by ID, if identity is its author, an editor or an admin
+// and ifMatch lists its current version
+func (blogs *Blogs) UpdateArticleByID(identity *Identity, ID, title, content, ifMatch string) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
 			return err
 		}
-
-		return tx.Set(ref, map[string]interface{}{
-			"title":       title,
-			"content":     content,
-			"modified_at": time.Now().String(),
-		}, firestore.MergeAll)
+		if err := checkIfMatch(ifMatch)(article); err != nil {
+			return err
+		}
+		article.Title = title
+		article.Content = content
+		modifiedAt := time.Now().UTC()
+		article.ModifiedAt = &modifiedAt
+		return nil
 	})
-	return err
 }
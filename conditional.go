@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache-Control policies used unless CACHE_CONTROL_PUBLIC and CACHE_CONTROL_PRIVATE are set
+const (
+	// defaultPublicCacheControl lets browsers and CDNs keep published articles for a minute before revalidating them
+	defaultPublicCacheControl = "public, max-age=60"
+	// defaultPrivateCacheControl keeps drafts and archived articles out of shared caches and revalidates them on every read
+	defaultPrivateCacheControl = "private, no-cache"
+)
+
+// ErrPreconditionFailed is returned when the If-Match header of a request does not list the current version of an article
+var ErrPreconditionFailed = errors.New("the article was modified since it was read")
+
+// etag returns the strong entity tag of the current version of the article sent as JSON
+func (article *Article) etag() string {
+	return article.etagAs(jsonFormat)
+}
+
+// etagAs returns the strong entity tag of the current version of the article sent in format. Every format gets its own
+// tag, since the representations differ byte for byte, while the JSON tag stays the bare version it always was.
+func (article *Article) etagAs(format ResponseFormat) string {
+	if format.Name == jsonFormat.Name {
+		return `"` + strconv.Itoa(article.Version) + `"`
+	}
+	return `"` + strconv.Itoa(article.Version) + "-" + format.Name + `"`
+}
+
+// matchesIfMatch reports whether ifMatch, the value of an If-Match header, lists an entity tag of the current version
+// of the article in any format. An empty header always matches, and weak entity tags never do since If-Match uses the
+// strong comparison.
+func (article *Article) matchesIfMatch(ifMatch string) bool {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	for _, etag := range strings.Split(ifMatch, ",") {
+		for _, format := range articleFormats {
+			if strings.TrimSpace(etag) == article.etagAs(format) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkIfMatch returns a check for ArticleStore.Delete and ArticleStore.Update which rejects the article
+// unless ifMatch lists its current version
+func checkIfMatch(ifMatch string) func(article *Article) error {
+	return func(article *Article) error {
+		if !article.matchesIfMatch(ifMatch) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+}
+
+// cacheControlFor returns the Cache-Control policy of a response holding articles with given status
+func cacheControlFor(status ArticleStatus) string {
+	if status == StatusPublished {
+		if env.CacheControlPublic != "" {
+			return env.CacheControlPublic
+		}
+		return defaultPublicCacheControl
+	}
+	if env.CacheControlPrivate != "" {
+		return env.CacheControlPrivate
+	}
+	return defaultPrivateCacheControl
+}
+
+// listETag returns a weak entity tag of a list response sent in format, derived from its JSON encoding
+func listETag(statusMessage Envelope, format ResponseFormat) string {
+	encoded, err := json.Marshal(statusMessage)
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(append([]byte(format.Name+"\n"), encoded...))
+	return `W/"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// lastModifiedOf returns when the most recently modified of the articles changed, or the zero time for no articles
+func lastModifiedOf(articles []*Article) time.Time {
+	var lastModified time.Time
+	for _, article := range articles {
+		if modifiedAt := article.modifiedOrCreatedAt(); modifiedAt.After(lastModified) {
+			lastModified = modifiedAt
+		}
+	}
+	return lastModified
+}
+
+// matchesIfNoneMatch reports whether ifNoneMatch, the value of an If-None-Match header, lists etag using the weak comparison
+func matchesIfNoneMatch(ifNoneMatch, etag string) bool {
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+	if ifNoneMatch == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified reports whether the conditional headers of request show that the client already holds the representation
+// with given etag and last modification time. If-Modified-Since is only considered without If-None-Match.
+func isNotModified(request *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && matchesIfNoneMatch(ifNoneMatch, etag)
+	}
+	ifModifiedSince, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// HTTP dates have a precision of one second
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// writeCacheHeaders sets the ETag, Last-Modified and Cache-Control headers of a successful read. When the client already
+// holds the representation it responds with 304 Not Modified and returns true, so the handler must not write a body.
+func writeCacheHeaders(response http.ResponseWriter, request *http.Request, etag string, lastModified time.Time, cacheControl string) bool {
+	if etag != "" {
+		response.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		response.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	response.Header().Set("Cache-Control", cacheControl)
+
+	if !isNotModified(request, etag, lastModified) {
+		return false
+	}
+	response.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatchGuardsUpdatesAndDeletes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		article := server.createArticle(token, "Versioned", "v1")
+		path := "/v1/articles/" + article.ID
+
+		recorder := server.do(http.MethodGet, path, token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		etag := recorder.Header().Get("ETag")
+		if etag != `"1"` {
+			t.Fatalf("expected the ETag of version 1, got %q", etag)
+		}
+
+		update := map[string]string{"title": "Versioned", "content": "v2"}
+		recorder = server.do(http.MethodPut, path, token, update, "If-Match", etag)
+		expectStatus(t, recorder, http.StatusOK)
+
+		// the ETag read before the update is stale now
+		recorder = server.do(http.MethodPut, path, token, update, "If-Match", etag)
+		expectProblem(t, recorder, http.StatusPreconditionFailed, CodeArticleVersionMismatch)
+		recorder = server.do(http.MethodDelete, path, token, nil, "If-Match", etag)
+		expectProblem(t, recorder, http.StatusPreconditionFailed, CodeArticleVersionMismatch)
+		// If-Match uses the strong comparison, so weak tags never match
+		recorder = server.do(http.MethodDelete, path, token, nil, "If-Match", `W/"2"`)
+		expectProblem(t, recorder, http.StatusPreconditionFailed, CodeArticleVersionMismatch)
+
+		recorder = server.do(http.MethodDelete, path, token, nil, "If-Match", `"1", "2"`)
+		expectStatus(t, recorder, http.StatusOK)
+	})
+}
+
+func TestConditionalGetRespondsNotModified(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		article := server.createArticle(token, "Cached", "v1")
+		path := "/v1/articles/" + article.ID
+
+		recorder := server.do(http.MethodGet, path, token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		etag := recorder.Header().Get("ETag")
+		lastModified := recorder.Header().Get("Last-Modified")
+		if recorder.Header().Get("Cache-Control") != cacheControlFor(StatusPublished) {
+			t.Fatalf("expected the public Cache-Control of published articles, got %q", recorder.Header().Get("Cache-Control"))
+		}
+
+		recorder = server.do(http.MethodGet, path, token, nil, "If-None-Match", etag)
+		expectStatus(t, recorder, http.StatusNotModified)
+		if recorder.Body.Len() != 0 {
+			t.Fatalf("expected no body, got %q", recorder.Body.String())
+		}
+		recorder = server.do(http.MethodGet, path, token, nil, "If-Modified-Since", lastModified)
+		expectStatus(t, recorder, http.StatusNotModified)
+
+		update := map[string]string{"title": "Cached", "content": "v2"}
+		expectStatus(t, server.do(http.MethodPut, path, token, update), http.StatusOK)
+		recorder = server.do(http.MethodGet, path, token, nil, "If-None-Match", etag)
+		expectStatus(t, recorder, http.StatusOK)
+
+		recorder = server.do(http.MethodGet, "/v1/articles", token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		recorder = server.do(http.MethodGet, "/v1/articles", token, nil, "If-None-Match", recorder.Header().Get("ETag"))
+		expectStatus(t, recorder, http.StatusNotModified)
+	})
+}
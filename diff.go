@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxDiffLines is how many changed lines of a title or content are compared at most
+	maxDiffLines = 10000
+	// maxDiffEdits is how many lines may be added or removed at most, which bounds the time and memory a diff takes
+	maxDiffEdits = 1000
+)
+
+// ErrDiffTooLarge is returned when two revisions differ too much to be compared line by line
+var ErrDiffTooLarge = errors.New("the revisions differ by too many lines to be compared")
+
+// diffRevisions returns a unified style diff of the titles and contents of two revisions, keeping every unchanged line as context
+func diffRevisions(from, to *Revision) (string, error) {
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- revision %d\n+++ revision %d\n", from.Number, to.Number)
+	diff.WriteString("@@ title @@\n")
+	if err := writeLineDiff(&diff, from.Title, to.Title); err != nil {
+		return "", err
+	}
+	diff.WriteString("@@ content @@\n")
+	if err := writeLineDiff(&diff, from.Content, to.Content); err != nil {
+		return "", err
+	}
+	return diff.String(), nil
+}
+
+// writeLineDiff writes the lines of before and after prefixed by "-" when removed, "+" when added and " " when kept,
+// following a shortest edit script of lines
+func writeLineDiff(diff *strings.Builder, before, after string) error {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// the lines both start and end with are kept, which leaves only the changed part to be compared
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits, err := shortestEditScript(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if err != nil {
+		return err
+	}
+	for _, line := range a[:prefix] {
+		diff.WriteString(" " + line + "\n")
+	}
+	for _, line := range edits {
+		diff.WriteString(line + "\n")
+	}
+	for _, line := range a[len(a)-suffix:] {
+		diff.WriteString(" " + line + "\n")
+	}
+	return nil
+}
+
+// shortestEditScript returns the lines turning a into b prefixed like writeLineDiff, using the O(ND) algorithm of
+// Eugene W. Myers. It returns ErrDiffTooLarge when a or b is longer than maxDiffLines, or when more than maxDiffEdits
+// lines must be added or removed.
+func shortestEditScript(a, b []string) ([]string, error) {
+	n, m := len(a), len(b)
+	if n > maxDiffLines || m > maxDiffLines {
+		return nil, ErrDiffTooLarge
+	}
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	// furthest[offset+k] is the furthest x reached on diagonal k = x - y, trace[d] holds diagonals -d to d after d edits
+	offset := limit + 1
+	furthest := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && furthest[offset+k-1] < furthest[offset+k+1]) {
+				x = furthest[offset+k+1]
+			} else {
+				x = furthest[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			furthest[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackEditScript(a, b, trace), nil
+			}
+		}
+		trace = append(trace, append([]int(nil), furthest[offset-d:offset+d+1]...))
+	}
+	return nil, ErrDiffTooLarge
+}
+
+// backtrackEditScript follows the furthest reaching paths of trace back from the end of a and b
+func backtrackEditScript(a, b []string, trace [][]int) []string {
+	var reversed []string
+	x, y := len(a), len(b)
+	for d := len(trace); d > 0; d-- {
+		previous := trace[d-1]
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && previous[k-1+d-1] < previous[k+1+d-1]) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := previous[previousK+d-1]
+		previousY := previousX - previousK
+		for x > previousX && y > previousY {
+			x--
+			y--
+			reversed = append(reversed, " "+a[x])
+		}
+		if previousK == k+1 {
+			reversed = append(reversed, "+"+b[previousY])
+		} else {
+			reversed = append(reversed, "-"+a[previousX])
+		}
+		x, y = previousX, previousY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, " "+a[x])
+	}
+
+	edits := make([]string, len(reversed))
+	for i, line := range reversed {
+		edits[len(reversed)-1-i] = line
+	}
+	return edits
+}
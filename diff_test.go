@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteLineDiff(t *testing.T) {
+	for _, test := range []struct {
+		before, after, want string
+	}{
+		{"a\nb\nc", "a\nb\nc", " a\n b\n c\n"},
+		{"a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c\n"},
+		{"a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"a\nb\nc\nd", "b\nd\ne", "-a\n b\n-c\n d\n+e\n"},
+		{"", "a", "-\n+a\n"},
+	} {
+		var diff strings.Builder
+		if err := writeLineDiff(&diff, test.before, test.after); err != nil {
+			t.Fatal(err)
+		}
+		if diff.String() != test.want {
+			t.Errorf("diff of %q and %q is %q, expected %q", test.before, test.after, diff.String(), test.want)
+		}
+	}
+}
+
+func TestWriteLineDiffTooLarge(t *testing.T) {
+	var before, after []string
+	for i := 0; i < maxDiffEdits; i++ {
+		before = append(before, "old")
+		after = append(after, "new")
+	}
+	var diff strings.Builder
+	if err := writeLineDiff(&diff, strings.Join(before, "\n"), strings.Join(after, "\n")); err != ErrDiffTooLarge {
+		t.Fatalf("expected ErrDiffTooLarge, got %v", err)
+	}
+
+	// unchanged lines are not compared, so long articles with a small change can still be diffed
+	lines := strings.Repeat("same\n", 2*maxDiffLines)
+	diff.Reset()
+	if err := writeLineDiff(&diff, lines+"old", lines+"new"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(diff.String(), "-old\n+new\n") {
+		t.Fatalf("unexpected diff ending %q", diff.String()[diff.Len()-20:])
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DocumentError is a structured error describing a stored document which could not be decoded into its typed struct
+type DocumentError struct {
+	Collection string `json:"collection" xml:"collection"`
+	ID         string `json:"id" xml:"id"`
+	Field      string `json:"field,omitempty" xml:"field,omitempty"`
+	Reason     string `json:"reason" xml:"reason"`
+}
+
+func (err *DocumentError) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("invalid document %s/%s: %s", err.Collection, err.ID, err.Reason)
+	}
+	return fmt.Sprintf("invalid document %s/%s: field %s %s", err.Collection, err.ID, err.Field, err.Reason)
+}
+
+// documentDecoder reads typed fields out of the raw data of a stored document.
+// It keeps the first problem it finds, so fields can be read one after another and checked once with Err.
+type documentDecoder struct {
+	collection string
+	ID         string
+	data       map[string]interface{}
+	err        *DocumentError
+}
+
+func newDocumentDecoder(collection, ID string, data map[string]interface{}) *documentDecoder {
+	return &documentDecoder{collection: collection, ID: ID, data: data}
+}
+
+func (decoder *documentDecoder) fail(field, reason string, args ...interface{}) {
+	if decoder.err == nil {
+		decoder.err = &DocumentError{
+			Collection: decoder.collection,
+			ID:         decoder.ID,
+			Field:      field,
+			Reason:     fmt.Sprintf(reason, args...),
+		}
+	}
+}
+
+// Err returns the first problem found while decoding, or nil
+func (decoder *documentDecoder) Err() error {
+	if decoder.err == nil {
+		return nil
+	}
+	return decoder.err
+}
+
+func (decoder *documentDecoder) optionalString(field string) (string, bool) {
+	switch value := decoder.data[field].(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	default:
+		decoder.fail(field, "must be a string, got %T", value)
+		return "", false
+	}
+}
+
+func (decoder *documentDecoder) optionalInteger(field string) (int, bool) {
+	switch value := decoder.data[field].(type) {
+	case nil:
+		return 0, false
+	case int64:
+		return int(value), true
+	case int:
+		return value, true
+	default:
+		decoder.fail(field, "must be an integer, got %T", value)
+		return 0, false
+	}
+}
+
+func (decoder *documentDecoder) requiredString(field string) string {
+	value, ok := decoder.optionalString(field)
+	if !ok {
+		decoder.fail(field, "is missing")
+	}
+	return value
+}
+
+// optionalTimestamp reads a native timestamp, or a string written before migration 1 converted timestamps
+func (decoder *documentDecoder) optionalTimestamp(field string) *time.Time {
+	var timestamp time.Time
+	var err error
+	switch value := decoder.data[field].(type) {
+	case nil:
+		return nil
+	case time.Time:
+		// the SQLite driver returns the zero time for TIMESTAMP columns holding unparseable text
+		if value.IsZero() {
+			decoder.fail(field, "is not a valid timestamp")
+			return nil
+		}
+		timestamp = value.UTC()
+	case string:
+		if value == "" {
+			return nil
+		}
+		timestamp, err = parseStoredTimestamp(value)
+	case []byte:
+		timestamp, err = parseStoredTimestamp(string(value))
+	default:
+		decoder.fail(field, "must be a timestamp, got %T", value)
+		return nil
+	}
+	if err != nil {
+		decoder.fail(field, "is not a valid timestamp: %v", err)
+		return nil
+	}
+	return &timestamp
+}
+
+func (decoder *documentDecoder) requiredTimestamp(field string) time.Time {
+	timestamp := decoder.optionalTimestamp(field)
+	if timestamp == nil {
+		decoder.fail(field, "is missing")
+		return time.Time{}
+	}
+	return *timestamp
+}
+
+// parseStoredTimestamp parses a timestamp stored as text, either by the SQLite store or as legacy time.Now().String()
+func parseStoredTimestamp(value string) (time.Time, error) {
+	if timestamp, err := time.Parse(sqliteTimestampLayout, value); err == nil {
+		return timestamp.UTC(), nil
+	}
+	return parseLegacyTimestamp(value)
+}
+
+// decodeArticle decodes and validates the raw fields of a stored article
+func decodeArticle(collection, ID string, data map[string]interface{}) (*Article, error) {
+	decoder := newDocumentDecoder(collection, ID, data)
+	authorID, _ := decoder.optionalString("author_id")
+	status, hasStatus := decoder.optionalString("status")
+	version, hasVersion := decoder.optionalInteger("version")
+	article := &Article{
+		ID:          ID,
+		AuthorID:    authorID,
+		Title:       decoder.requiredString("title"),
+		Content:     decoder.requiredString("content"),
+		Status:      ArticleStatus(status),
+		Version:     version,
+		CreatedAt:   decoder.requiredTimestamp("created_at"),
+		ModifiedAt:  decoder.optionalTimestamp("modified_at"),
+		PublishedAt: decoder.optionalTimestamp("published_at"),
+		PublishAt:   decoder.optionalTimestamp("publish_at"),
+		DeletedAt:   decoder.optionalTimestamp("deleted_at"),
+	}
+	// articles written before statuses existed were public as soon as they were created
+	if !hasStatus {
+		article.Status = StatusPublished
+	}
+	// articles written before versions existed are still in their first version
+	if !hasVersion {
+		article.Version = 1
+	}
+	if decoder.Err() == nil && !article.Status.isValid() {
+		decoder.fail("status", "is not a known status")
+	}
+	if err := decoder.Err(); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// decodeUser decodes and validates the raw fields of a stored user
+func decodeUser(collection, ID string, data map[string]interface{}) (*User, error) {
+	decoder := newDocumentDecoder(collection, ID, data)
+	role, hasRole := decoder.optionalString("role")
+	// users stored by their first Firebase ID token have an empty password, which no password matches
+	user := &User{
+		GeneratedID: decoder.requiredString("id"),
+		Email:       decoder.requiredString("email"),
+		Password:    decoder.requiredString("password"),
+		Role:        Role(role),
+	}
+	// users registered before roles existed could already write articles
+	if !hasRole {
+		user.Role = defaultRole
+	}
+	if decoder.Err() == nil && !user.Role.isValid() {
+		decoder.fail("role", "is not a known role")
+	}
+	if decoder.Err() == nil && !strings.Contains(user.Email, "@") {
+		decoder.fail("email", "is not an email address")
+	}
+	if err := decoder.Err(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// decodeRefreshToken decodes and validates the raw fields of a stored refresh token
+func decodeRefreshToken(collection, ID string, data map[string]interface{}) (*RefreshToken, error) {
+	decoder := newDocumentDecoder(collection, ID, data)
+	token := &RefreshToken{
+		ID:        ID,
+		FamilyID:  decoder.requiredString("family_id"),
+		UserID:    decoder.requiredString("user_id"),
+		CreatedAt: decoder.requiredTimestamp("created_at"),
+		ExpiresAt: decoder.requiredTimestamp("expires_at"),
+		UsedAt:    decoder.optionalTimestamp("used_at"),
+		RevokedAt: decoder.optionalTimestamp("revoked_at"),
+	}
+	if err := decoder.Err(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/iterator"
+)
+
+// AuthClient is the part of the Firebase Authentication Admin SDK used by the API
+type AuthClient interface {
+	CreateUser(ctx context.Context, user *auth.UserToCreate) (*auth.UserRecord, error)
+	DeleteUser(ctx context.Context, uid string) error
+	RevokeRefreshTokens(ctx context.Context, uid string) error
+	SetCustomUserClaims(ctx context.Context, uid string, customClaims map[string]interface{}) error
+	VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error)
+	// ListUsers returns every user of the Firebase project
+	ListUsers(ctx context.Context) ([]*auth.ExportedUserRecord, error)
+}
+
+// firebaseAuthClient is an AuthClient calling Firebase Authentication through the Admin SDK
+type firebaseAuthClient struct {
+	*auth.Client
+}
+
+// ListUsers pages through every user of the Firebase project
+func (client firebaseAuthClient) ListUsers(ctx context.Context) ([]*auth.ExportedUserRecord, error) {
+	var records []*auth.ExportedUserRecord
+	userIter := client.Users(ctx, "")
+	for {
+		record, err := userIter.Next()
+		if err == iterator.Done {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
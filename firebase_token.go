@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// firebaseIssuerPrefix starts the iss claim of every Firebase ID token, followed by the project ID
+const firebaseIssuerPrefix = "https://securetoken.google.com/"
+
+// unverifiedClaims returns the claims of a token without checking its signature, or nil when it is not a JWT.
+// They must only be used to decide how to verify the token.
+func unverifiedClaims(tokenString string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// isFirebaseIDToken reports whether a token claims to be issued by Firebase Authentication
+func isFirebaseIDToken(tokenString string) bool {
+	issuer, _ := unverifiedClaims(tokenString)["iss"].(string)
+	return strings.HasPrefix(issuer, firebaseIssuerPrefix)
+}
+
+// firebaseTokenID identifies a Firebase ID token inside the revocation store, since it carries no jti
+func firebaseTokenID(idToken string) string {
+	hash := sha256.Sum256([]byte(idToken))
+	return "firebase:" + hex.EncodeToString(hash[:])
+}
+
+// verifyFirebaseIDToken returns the identity of the user a Firebase ID token was issued to, storing them on their first request,
+// or responds with the reason the token is rejected and returns nil.
+// The Admin SDK also checks whether the Firebase sessions of the user were revoked since the token was issued.
+func (users *Users) verifyFirebaseIDToken(response http.ResponseWriter, request *http.Request, idToken string) *Identity {
+	token, err := users.authClient.VerifyIDTokenAndCheckRevoked(request.Context(), idToken)
+	if auth.IsIDTokenRevoked(err) {
+		statusMessage := Error{
+			Code:   CodeAuthTokenRevoked,
+			Detail: "Auth Failed. The Firebase session was revoked, please sign in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+	if err != nil {
+		// the Admin SDK does not tell expired tokens apart, so the expiry is read from the unverified claims
+		expiresAt, _ := unverifiedClaims(idToken)["exp"].(float64)
+		if expiresAt != 0 && time.Now().Unix() >= int64(expiresAt) {
+			statusMessage := Error{
+				Code:   CodeAuthTokenExpired,
+				Detail: "Auth Failed. The Firebase ID token has expired, please refresh it.",
+			}
+			ExitWithError(response, statusMessage)
+			return nil
+		}
+		log.Printf("error verifying a Firebase ID token: %v\n", err)
+		statusMessage := Error{
+			Code:   CodeAuthTokenInvalid,
+			Detail: "Auth Failed.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+
+	// Signup registers users under their Firebase UID, users who signed up through a Firebase client are stored on first use
+	user, err := users.store.GetUserByID(request.Context(), token.UID)
+	if err == ErrUserNotFound {
+		user, err = users.provisionFirebaseUser(request.Context(), token)
+	}
+	if err == errFirebaseUserWithoutEmail {
+		statusMessage := Error{
+			Code:   CodeAuthTokenInvalid,
+			Detail: "Auth Failed. The Firebase user has no email address.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+	if err == ErrUserAlreadyExists {
+		statusMessage := Error{
+			Code:   CodeUserAlreadyExists,
+			Detail: "Another user is registered with the email of this Firebase user.",
+		}
+		ExitWithError(response, statusMessage)
+		return nil
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return nil
+	}
+
+	return &Identity{
+		UserID:         user.GeneratedID,
+		Email:          user.Email,
+		Role:           user.effectiveRole(),
+		TokenID:        firebaseTokenID(idToken),
+		TokenIssuedAt:  time.Unix(token.IssuedAt, 0).UTC(),
+		TokenExpiresAt: time.Unix(token.Expires, 0).UTC(),
+	}
+}
+
+// errFirebaseUserWithoutEmail is returned when storing a Firebase user who signed in without an email address
+var errFirebaseUserWithoutEmail = errors.New("the Firebase user has no email address")
+
+// provisionFirebaseUser stores the user a verified Firebase ID token was issued to, with the default role.
+// The user signed up through a Firebase client, so they have no password and cannot log in through Login.
+func (users *Users) provisionFirebaseUser(ctx context.Context, token *auth.Token) (*User, error) {
+	email, _ := token.Claims["email"].(string)
+	if email == "" {
+		return nil, errFirebaseUserWithoutEmail
+	}
+	user := &User{
+		GeneratedID: token.UID,
+		Email:       strings.ToLower(email),
+		Role:        defaultRole,
+	}
+	err := users.store.AddUser(ctx, user)
+	if err == ErrUserAlreadyExists {
+		// a concurrent request with a token of the same user may have stored it first
+		if stored, getErr := users.store.GetUserByID(ctx, token.UID); getErr == nil {
+			return stored, nil
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Stored Firebase user %s (%s) on their first request\n", user.GeneratedID, user.Email)
+	return user, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// fakeAuthClient is an AuthClient keeping Firebase users in memory, which accepts the ID tokens it issued
+type fakeAuthClient struct {
+	users    map[string]*auth.ExportedUserRecord
+	idTokens map[string]*auth.Token
+	created  int
+}
+
+func newFakeAuthClient() *fakeAuthClient {
+	return &fakeAuthClient{users: map[string]*auth.ExportedUserRecord{}, idTokens: map[string]*auth.Token{}}
+}
+
+// addUser stores a Firebase user created at createdAt
+func (client *fakeAuthClient) addUser(UID, email string, createdAt time.Time) *auth.ExportedUserRecord {
+	record := &auth.ExportedUserRecord{UserRecord: &auth.UserRecord{
+		UserInfo:     &auth.UserInfo{UID: UID, Email: email},
+		UserMetadata: &auth.UserMetadata{CreationTimestamp: createdAt.UnixNano() / int64(time.Millisecond)},
+	}}
+	client.users[UID] = record
+	return record
+}
+
+// issueIDToken returns an ID token of the Firebase user by UID, which is only valid for this client
+func (client *fakeAuthClient) issueIDToken(t *testing.T, UID string, claims map[string]interface{}) string {
+	t.Helper()
+	now := time.Now()
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": firebaseIssuerPrefix + "test-project",
+		"sub": UID,
+		"exp": now.Add(time.Hour).Unix(),
+	}).SignedString([]byte("fake"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.idTokens[idToken] = &auth.Token{UID: UID, IssuedAt: now.Unix(), Expires: now.Add(time.Hour).Unix(), Claims: claims}
+	return idToken
+}
+
+func (client *fakeAuthClient) CreateUser(ctx context.Context, user *auth.UserToCreate) (*auth.UserRecord, error) {
+	client.created++
+	return client.addUser("created-"+strconv.Itoa(client.created), "", time.Now()).UserRecord, nil
+}
+
+func (client *fakeAuthClient) DeleteUser(ctx context.Context, uid string) error {
+	delete(client.users, uid)
+	return nil
+}
+
+func (client *fakeAuthClient) RevokeRefreshTokens(ctx context.Context, uid string) error {
+	return nil
+}
+
+func (client *fakeAuthClient) SetCustomUserClaims(ctx context.Context, uid string, customClaims map[string]interface{}) error {
+	record, ok := client.users[uid]
+	if !ok {
+		return errors.New("unknown user " + uid)
+	}
+	record.CustomClaims = customClaims
+	return nil
+}
+
+func (client *fakeAuthClient) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	token, ok := client.idTokens[idToken]
+	if !ok {
+		return nil, errors.New("unknown ID token")
+	}
+	return token, nil
+}
+
+func (client *fakeAuthClient) ListUsers(ctx context.Context) ([]*auth.ExportedUserRecord, error) {
+	var records []*auth.ExportedUserRecord
+	for _, record := range client.users {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func TestFirebaseUserIsStoredOnFirstRequest(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		authClient := newFakeAuthClient()
+		server.users.authClient = authClient
+		authClient.addUser("web-client-user", "web@example.com", time.Now())
+		idToken := authClient.issueIDToken(t, "web-client-user", map[string]interface{}{"email": "web@example.com"})
+
+		// the user signed up through a Firebase client, so the API never saw them before
+		for attempt := 0; attempt < 2; attempt++ {
+			expectStatus(t, server.do(http.MethodGet, "/v1/articles", idToken, nil), http.StatusOK)
+		}
+		user, err := server.users.store.GetUserByID(context.Background(), "web-client-user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "web@example.com" || user.Role != defaultRole || user.Password != "" {
+			t.Fatalf("unexpected stored user %+v", user)
+		}
+		article := server.createArticle(idToken, "From the web", "content")
+		if article.AuthorID != "web-client-user" {
+			t.Fatalf("expected the article to be written by the Firebase user, got %+v", article)
+		}
+
+		// without a password of the API, the user can only sign in through Firebase
+		credentials := map[string]string{"email": "web@example.com", "password": ""}
+		expectProblem(t, server.do(http.MethodPost, "/v1/sessions", "", credentials), http.StatusUnauthorized, CodeLoginFailed)
+
+		withoutEmail := authClient.issueIDToken(t, "phone-user", map[string]interface{}{})
+		expectProblem(t, server.do(http.MethodGet, "/v1/articles", withoutEmail, nil), http.StatusUnauthorized, CodeAuthTokenInvalid)
+		if _, err := server.users.store.GetUserByID(context.Background(), "phone-user"); err != ErrUserNotFound {
+			t.Fatalf("expected the user without email not to be stored, got %v", err)
+		}
+
+		server.login("taken@example.com")
+		sameEmail := authClient.issueIDToken(t, "other-user", map[string]interface{}{"email": "taken@example.com"})
+		expectProblem(t, server.do(http.MethodGet, "/v1/articles", sameEmail, nil), http.StatusConflict, CodeUserAlreadyExists)
+	})
+}
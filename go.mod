@@ -7,9 +7,14 @@ require (
 	cloud.google.com/go/storage v1.10.0 // indirect
 	firebase.google.com/go v3.13.0+incompatible
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/evanphx/json-patch v4.12.0+incompatible
+	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/gorilla/mux v1.7.4
 	github.com/joho/godotenv v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.uber.org/yarpc v1.46.0 // indirect
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	google.golang.org/api v0.29.0
+	google.golang.org/grpc v1.29.1
 )
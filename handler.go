@@ -1,264 +1,802 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/gorilla/mux"
 )
 
 // HelloWorld greets the world for testing purpose
 func HelloWorld(response http.ResponseWriter, request *http.Request) {
 	greeting := "Hello World!"
-	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(greeting)
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: greeting}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
-// Blogs is a structure which holds database and handler for database operation over HTTP calls
+// Blogs is a structure which holds article store and handler for database operation over HTTP calls
 type Blogs struct {
-	db *firestore.Client
+	store ArticleStore
 }
 
 // Article is a standard format of single blog post data (document snapshot)
 type Article struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Content    string `json:"content"`
-	CreatedAt  string `json:"created_at"`
-	ModifiedAt string `json:"modified_at,omitempty"`
+	ID       string        `json:"id" xml:"id"`
+	AuthorID string        `json:"author_id,omitempty" xml:"author_id,omitempty"`
+	Title    string        `json:"title" xml:"title"`
+	Content  string        `json:"content" xml:"content"`
+	Status   ArticleStatus `json:"status" xml:"status"`
+	// Version is incremented by the store on every change and exposed as the ETag of the article
+	Version     int        `json:"version" xml:"version"`
+	CreatedAt   time.Time  `json:"created_at" xml:"created_at"`
+	ModifiedAt  *time.Time `json:"modified_at,omitempty" xml:"modified_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty" xml:"published_at,omitempty"`
+	// PublishAt is when a draft is scheduled to be published by the publish scheduler
+	PublishAt *time.Time `json:"publish_at,omitempty" xml:"publish_at,omitempty"`
+	// DeletedAt is when the article was moved to the trash, which hides it until it is restored or purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
 }
 
-func initBlogs(db *firestore.Client) *Blogs {
-	return &Blogs{db: db}
+func initBlogs(store ArticleStore) *Blogs {
+	return &Blogs{store: store}
 }
 
-// ListAllArticlesHandler lists all articles available inside the DB
+// ListAllArticlesHandler lists a page of articles available inside the DB, sorted and filtered by the query parameters.
+// The next page is requested by passing next_cursor of the response as the cursor query parameter.
+// Pages carry an ETag and Last-Modified, so polling clients can revalidate them with a conditional request.
 func (blogs *Blogs) ListAllArticlesHandler(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
-
-	if request.Method != http.MethodGet {
-		statusCode := http.StatusMethodNotAllowed
+	response.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(request, articleFormats)
+	if !ok {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeNotAcceptable,
+			Detail: "Articles can be sent as " + contentTypesOf(articleFormats) + ".",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	allArticles, err := blogs.getAllArticles()
+	query, err := parseArticleQuery(request)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeValidationFailed,
+			Detail: err.Error(),
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	allArticles, err := blogs.listArticles(identityFromContext(request.Context()), query)
+	if err == ErrUnsupportedQuery {
+		statusMessage := Error{
+			Code:   CodeUnsupportedQuery,
+			Detail: err.Error(),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
 		return
 	}
 	statusCode := http.StatusOK
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), allArticles)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := articleListEnvelope(request, allArticles)
+	if writeCacheHeaders(response, request, listETag(statusMessage, format), lastModifiedOf(allArticles.Articles), cacheControlFor(query.Status)) {
+		return
+	}
+	writeResponseAs(response, request, statusCode, statusMessage, format)
 }
 
-// PublishArticleHandler publishes an article with given title and content
-func (blogs *Blogs) PublishArticleHandler(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
+// PublishArticleHandler creates an article with given title and content, with defaultStatus unless status is given.
+// A draft is scheduled to be published at publish_at, when given.
+func (blogs *Blogs) PublishArticleHandler(defaultStatus ArticleStatus) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		input, err := decodeInput(request, "title", "content", "status", "publish_at")
+		if err != nil {
+			exitWithInputError(response, err)
+			return
+		}
+		title, isTitleFound := input["title"]
+		content, isContentFound := input["content"]
+
+		if isTitleFound == false || isContentFound == false {
+			statusMessage := Error{
+				Code:   CodeValidationFailed,
+				Detail: "Both title and content are required.",
+				Errors: missingFields(input, "title", "content"),
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		status := defaultStatus
+		if statusInput := input.Get("status"); statusInput != "" {
+			status = ArticleStatus(statusInput)
+		}
+		if status != StatusDraft && status != StatusPublished {
+			statusMessage := Error{
+				Code:   CodeValidationFailed,
+				Detail: "Status must be either draft or published.",
+				Errors: []FieldError{{Field: "status", Reason: "must be either draft or published"}},
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		var publishAt *time.Time
+		if publishAtInput := input.Get("publish_at"); publishAtInput != "" {
+			timestamp, err := parseQueryTimestamp("publish_at", publishAtInput)
+			if err != nil {
+				statusMessage := Error{
+					Code:   CodeValidationFailed,
+					Detail: err.Error(),
+					Errors: []FieldError{{Field: "publish_at", Reason: "is not a valid timestamp"}},
+				}
+				ExitWithError(response, statusMessage)
+				return
+			}
+			publishAt = timestamp
+		}
+
+		author := identityFromContext(request.Context())
+		if author == nil {
+			statusMessage := Error{
+				Code: CodeAuthTokenMissing,
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		newArticleID, err := blogs.AddArticle(author, title[0], content[0], status, publishAt)
+		if err == ErrArticleNotDraft || err == ErrPublishAtInPast {
+			statusMessage := Error{
+				Code:   CodeValidationFailed,
+				Detail: err.Error(),
+				Errors: []FieldError{{Field: "publish_at", Reason: err.Error()}},
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+
+		newArticle, err := blogs.GetArticleByID(newArticleID)
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
 
-	if request.Method != http.MethodPost {
-		statusCode := http.StatusMethodNotAllowed
+		statusCode := http.StatusCreated
+		statusMessage := Envelope{Data: newArticle}
+		writeResponse(response, request, statusCode, statusMessage)
+	}
+}
+
+// ListArticleHandler lists an article by ID along with its version as ETag and its modification time as Last-Modified,
+// drafts and archived articles are only found by their author, editors and admins
+func (blogs *Blogs) ListArticleHandler(response http.ResponseWriter, request *http.Request) {
+	response.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(request, articleFormats)
+	if !ok {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeNotAcceptable,
+			Detail: "Articles can be sent as " + contentTypesOf(articleFormats) + ".",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	request.ParseForm()
-	urlEncodedFormInputMap := request.Form
-	title, isTitleFound := urlEncodedFormInputMap["title"]
-	content, isContentFound := urlEncodedFormInputMap["content"]
+	param := mux.Vars(request)
+	ID := param["id"]
 
-	if isTitleFound == false || isContentFound == false {
-		statusCode := http.StatusBadRequest
+	if len(ID) == 0 {
 		statusMessage := Error{
-			Message:       http.StatusText(statusCode),
-			CustomMessage: "Both title and content are required.",
+			Code: CodeMalformedRequest,
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	result, _, err := blogs.AddArticle(title[0], content[0])
-
+	article, err := blogs.GetArticleByID(ID)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
+		exitWithStoreError(response, err)
+		return
+	}
+
+	// unpublished articles are reported as missing, so that their existence is not revealed
+	if !identityFromContext(request.Context()).canView(article) {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code: CodeArticleNotFound,
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	newArticle, err := blogs.GetArticleByID(result.ID)
+	if writeCacheHeaders(response, request, article.etagAs(format), article.modifiedOrCreatedAt(), cacheControlFor(article.Status)) {
+		return
+	}
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: article}
+	writeResponseAs(response, request, statusCode, statusMessage, format)
+}
+
+// DeleteArticleHandler moves an article by ID to the trash, only if the If-Match header lists its current ETag when given
+func (blogs *Blogs) DeleteArticleHandler(response http.ResponseWriter, request *http.Request) {
+	param := mux.Vars(request)
+	ID := param["id"]
+	if len(ID) == 0 {
+		statusMessage := Error{
+			Code: CodeMalformedRequest,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	article, err := blogs.GetArticleByID(ID)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
+		exitWithStoreError(response, err)
+		return
+	}
+	// unpublished articles of other authors are reported as missing, like ListArticleHandler does
+	if !identityFromContext(request.Context()).canView(article) {
+		statusMessage := Error{
+			Code: CodeArticleNotFound,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	err = blogs.DeleteArticleByID(identityFromContext(request.Context()), ID, request.Header.Get("If-Match"))
+	if err == ErrPreconditionFailed {
+		statusMessage := Error{
+			Code:   CodeArticleVersionMismatch,
+			Detail: "The blog post was modified since it was read, fetch it again before deleting it.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrNotArticleAuthor {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can modify it.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
 		return
 	}
 
-	statusCode := http.StatusCreated
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), newArticle)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	customMessage := fmt.Sprintf("The Blog post with ID %s was moved to the trash.", ID)
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: customMessage}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
-// ListArticleHandler lists an article by ID
-func (blogs *Blogs) ListArticleHandler(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
+// UpdateArticleHandler updates an article by ID, only if the If-Match header lists its current ETag when given
+func (blogs *Blogs) UpdateArticleHandler(response http.ResponseWriter, request *http.Request) {
+	input, err := decodeInput(request, "title", "content")
+	if err != nil {
+		exitWithInputError(response, err)
+		return
+	}
+	title, isTitleFound := input["title"]
+	content, isContentFound := input["content"]
 
-	if request.Method != http.MethodGet {
-		statusCode := http.StatusMethodNotAllowed
+	if isTitleFound == false || isContentFound == false {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeValidationFailed,
+			Detail: "Both title and content are required.",
+			Errors: missingFields(input, "title", "content"),
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
 	param := mux.Vars(request)
 	ID := param["id"]
-
 	if len(ID) == 0 {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code: CodeMalformedRequest,
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	article, err := blogs.GetArticleByID(ID)
-	if err != nil {
-		statusCode := http.StatusServiceUnavailable
+	err = blogs.UpdateArticleByID(identityFromContext(request.Context()), ID, title[0], content[0], request.Header.Get("If-Match"))
+	if err == ErrPreconditionFailed {
+		statusMessage := Error{
+			Code:   CodeArticleVersionMismatch,
+			Detail: "The blog post was modified since it was read, fetch it again before saving your changes.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrNotArticleAuthor {
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can modify it.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
 		return
 	}
 
+	customMessage := fmt.Sprintf("The Blog post with ID %s was successfully updated.", ID)
 	statusCode := http.StatusOK
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), article)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := Envelope{Data: customMessage}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
-// DeleteArticleHandler deletes an article by ID
-func (blogs *Blogs) DeleteArticleHandler(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
+// ChangeArticleStatusHandler returns a handler which moves an article by ID to status, to publish, unpublish or archive it
+func (blogs *Blogs) ChangeArticleStatusHandler(status ArticleStatus) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		param := mux.Vars(request)
+		ID := param["id"]
+		if len(ID) == 0 {
+			statusMessage := Error{
+				Code: CodeMalformedRequest,
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		err := blogs.ChangeArticleStatusByID(identityFromContext(request.Context()), ID, status)
+		if err == ErrArticleNotFound {
+			statusMessage := Error{
+				Code: CodeArticleNotFound,
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if err == ErrNotArticleAuthor {
+			statusMessage := Error{
+				Code:   CodeNotArticleAuthor,
+				Detail: "Only the author of this blog post, an editor or an admin can modify it.",
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if err == ErrArticleStatusUnchanged {
+			statusMessage := Error{
+				Code:   CodeArticleStateConflict,
+				Detail: fmt.Sprintf("The Blog post with ID %s is already %s.", ID, status),
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
 
-	if request.Method != http.MethodDelete {
-		statusCode := http.StatusMethodNotAllowed
+		article, err := blogs.GetArticleByID(ID)
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+
+		statusCode := http.StatusOK
+		statusMessage := Envelope{Data: article}
+		writeResponse(response, request, statusCode, statusMessage)
+	}
+}
+
+// ListScheduledArticlesHandler lists the drafts scheduled for publication, authors only see their own drafts
+func (blogs *Blogs) ListScheduledArticlesHandler(response http.ResponseWriter, request *http.Request) {
+	scheduledArticles, err := blogs.listScheduledArticles(identityFromContext(request.Context()))
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := articleListEnvelope(request, scheduledArticles)
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// ScheduleArticleHandler schedules a draft by ID to be published at publish_at
+func (blogs *Blogs) ScheduleArticleHandler(response http.ResponseWriter, request *http.Request) {
+	input, err := decodeInput(request, "publish_at")
+	if err != nil {
+		exitWithInputError(response, err)
+		return
+	}
+	publishAt, err := parseQueryTimestamp("publish_at", input.Get("publish_at"))
+	if err != nil {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeValidationFailed,
+			Detail: err.Error(),
+			Errors: []FieldError{{Field: "publish_at", Reason: "is not a valid timestamp"}},
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
 	param := mux.Vars(request)
 	ID := param["id"]
 	if len(ID) == 0 {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code: CodeMalformedRequest,
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	_, err := blogs.GetArticleByID(ID)
+	err = blogs.ScheduleArticleByID(identityFromContext(request.Context()), ID, *publishAt)
+	blogs.respondToScheduleChange(response, request, ID, err)
+}
+
+// CancelScheduledArticleHandler cancels the scheduled publication of a draft by ID
+func (blogs *Blogs) CancelScheduledArticleHandler(response http.ResponseWriter, request *http.Request) {
+	param := mux.Vars(request)
+	ID := param["id"]
+	if len(ID) == 0 {
+		statusMessage := Error{
+			Code: CodeMalformedRequest,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	err := blogs.CancelScheduledArticleByID(identityFromContext(request.Context()), ID)
+	blogs.respondToScheduleChange(response, request, ID, err)
+}
+
+// respondToScheduleChange responds with the article by ID once its schedule was changed, or with the error preventing it
+func (blogs *Blogs) respondToScheduleChange(response http.ResponseWriter, request *http.Request, ID string, err error) {
+	if err == ErrArticleNotFound {
+		statusMessage := Error{
+			Code: CodeArticleNotFound,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrNotArticleAuthor {
+		statusMessage := Error{
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can modify it.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrPublishAtInPast {
+		statusMessage := Error{
+			Code:   CodeValidationFailed,
+			Detail: err.Error(),
+			Errors: []FieldError{{Field: "publish_at", Reason: "must be in the future"}},
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrArticleNotDraft || err == ErrArticleNotScheduled {
+		statusMessage := Error{
+			Code:   CodeArticleStateConflict,
+			Detail: err.Error(),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: article}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// ListRevisionsHandler lists every revision of an article by ID, oldest first
+func (blogs *Blogs) ListRevisionsHandler(response http.ResponseWriter, request *http.Request) {
+	ID := mux.Vars(request)["id"]
+	revisions, err := blogs.ListRevisionsByID(identityFromContext(request.Context()), ID)
+	if err != nil {
+		exitWithRevisionError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: revisions}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// GetRevisionHandler lists a single revision of an article by ID and revision number
+func (blogs *Blogs) GetRevisionHandler(response http.ResponseWriter, request *http.Request) {
+	param := mux.Vars(request)
+	number, err := strconv.Atoi(param["revision"])
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeMalformedRequest,
+			Detail: "The revision must be a number.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	_, err = blogs.DeleteArticleByID(ID)
+	revision, err := blogs.GetRevisionByID(identityFromContext(request.Context()), param["id"], number)
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
+		exitWithRevisionError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: revision}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// DiffRevisionsHandler lists a line based diff between the revisions from and to of an article by ID
+func (blogs *Blogs) DiffRevisionsHandler(response http.ResponseWriter, request *http.Request) {
+	values := request.URL.Query()
+	from, fromErr := strconv.Atoi(values.Get("from"))
+	to, toErr := strconv.Atoi(values.Get("to"))
+	if fromErr != nil || toErr != nil {
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeValidationFailed,
+			Detail: "Both from and to must be revision numbers.",
+		}
+		if fromErr != nil {
+			statusMessage.Errors = append(statusMessage.Errors, FieldError{Field: "from", Reason: "must be a revision number"})
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		if toErr != nil {
+			statusMessage.Errors = append(statusMessage.Errors, FieldError{Field: "to", Reason: "must be a revision number"})
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	diff, err := blogs.DiffRevisionsByID(identityFromContext(request.Context()), mux.Vars(request)["id"], from, to)
+	if err == ErrDiffTooLarge {
+		statusMessage := Error{
+			Code:   CodeDiffTooLarge,
+			Detail: "The revisions differ by too many lines to be compared, fetch both of them instead.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithRevisionError(response, err)
 		return
 	}
 
-	customMessage := fmt.Sprintf("The Blog post with ID %s was successfully deleted.", ID)
 	statusCode := http.StatusOK
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), customMessage)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := Envelope{Data: RevisionDiff{From: from, To: to, Diff: diff}}
+	writeResponse(response, request, statusCode, statusMessage)
 }
 
-// UpdateArticleHandler updates an article by ID
-func (blogs *Blogs) UpdateArticleHandler(response http.ResponseWriter, request *http.Request) {
-	response.Header().Set("Content-Type", "application/json")
+// RestoreRevisionHandler makes an older revision of an article by ID its current version
+func (blogs *Blogs) RestoreRevisionHandler(response http.ResponseWriter, request *http.Request) {
+	param := mux.Vars(request)
+	ID := param["id"]
+	number, err := strconv.Atoi(param["revision"])
+	if err != nil {
+		statusMessage := Error{
+			Code:   CodeMalformedRequest,
+			Detail: "The revision must be a number.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
 
-	if request.Method != http.MethodPut {
-		statusCode := http.StatusMethodNotAllowed
+	identity := identityFromContext(request.Context())
+	if err := blogs.RestoreRevisionByID(identity, ID, number); err != nil {
+		exitWithRevisionError(response, err)
+		return
+	}
+
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: article}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// exitWithRevisionError responds with the error preventing access to the revisions of an article
+func exitWithRevisionError(response http.ResponseWriter, err error) {
+	if err == ErrNotArticleAuthor {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can see and restore its revisions.",
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
+	exitWithStoreError(response, err)
+}
 
-	request.ParseForm()
-	urlEncodedFormInputMap := request.Form
-	title, isTitleFound := urlEncodedFormInputMap["title"]
-	content, isContentFound := urlEncodedFormInputMap["content"]
+// ListTrashHandler lists a page of the articles inside the trash, sorted and filtered like ListAllArticlesHandler.
+// Authors only see their own articles.
+func (blogs *Blogs) ListTrashHandler(response http.ResponseWriter, request *http.Request) {
+	query, err := parseArticleQuery(request)
+	if err != nil {
+		statusMessage := Error{
+			Code:   CodeValidationFailed,
+			Detail: err.Error(),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	query.Trashed = true
+	// the trash holds articles of every status, unless a status is asked for
+	if request.URL.Query().Get("status") == "" {
+		query.Status = ""
+	}
 
-	if isTitleFound == false || isContentFound == false {
-		statusCode := http.StatusBadRequest
+	trashedArticles, err := blogs.listArticles(identityFromContext(request.Context()), query)
+	if err == ErrUnsupportedQuery {
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code:   CodeUnsupportedQuery,
+			Detail: err.Error(),
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := articleListEnvelope(request, trashedArticles)
+	writeResponse(response, request, statusCode, statusMessage)
+}
 
+// RestoreArticleHandler moves an article by ID out of the trash
+func (blogs *Blogs) RestoreArticleHandler(response http.ResponseWriter, request *http.Request) {
 	param := mux.Vars(request)
 	ID := param["id"]
 	if len(ID) == 0 {
-		statusCode := http.StatusBadRequest
 		statusMessage := Error{
-			Message: http.StatusText(statusCode),
+			Code: CodeMalformedRequest,
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	err := blogs.UpdateArticleByID(ID, title[0], content[0])
+	err := blogs.RestoreArticleByID(identityFromContext(request.Context()), ID)
+	if err == ErrArticleNotFound {
+		statusMessage := Error{
+			Code: CodeArticleNotFound,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrNotArticleAuthor {
+		statusMessage := Error{
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can modify it.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrArticleNotTrashed {
+		statusMessage := Error{
+			Code:   CodeArticleStateConflict,
+			Detail: fmt.Sprintf("The Blog post with ID %s is not inside the trash.", ID),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: article}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// PatchArticleHandler partially updates an article by ID with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902),
+// only if the If-Match header lists its current ETag when given
+func (blogs *Blogs) PatchArticleHandler(response http.ResponseWriter, request *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	body, err := readRequestBody(request)
+	if err != nil {
+		exitWithInputError(response, err)
+		return
+	}
+	patch, err := parseArticlePatch(mediaType, body)
+	if err == ErrUnsupportedPatchType {
+		statusMessage := Error{
+			Code:   CodeUnsupportedMediaType,
+			Detail: err.Error(),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
 	if err != nil {
-		statusCode := http.StatusServiceUnavailable
 		statusMessage := Error{
-			// err.Error() is a custom error message from client firestore API
-			Message: err.Error(),
+			Code:   CodeMalformedRequest,
+			Detail: err.Error(),
 		}
-		ExitWithError(response, statusCode, statusMessage)
+		ExitWithError(response, statusMessage)
 		return
 	}
 
-	customMessage := fmt.Sprintf("The Blog post with ID %s was successfully updated.", ID)
+	ID := mux.Vars(request)["id"]
+	err = blogs.PatchArticleByID(identityFromContext(request.Context()), ID, patch, request.Header.Get("If-Match"))
+	switch err := err.(type) {
+	case *PatchConflictError:
+		statusMessage := Error{
+			Code:   CodePatchConflict,
+			Detail: err.Error(),
+		}
+		ExitWithError(response, statusMessage)
+		return
+	case *InvalidArticleError:
+		statusMessage := Error{
+			Code:   CodeArticleInvalid,
+			Detail: err.Error(),
+		}
+		if err.Field != "" {
+			statusMessage.Errors = []FieldError{{Field: err.Field, Reason: err.Reason}}
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrArticleNotFound {
+		statusMessage := Error{
+			Code: CodeArticleNotFound,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrPreconditionFailed {
+		statusMessage := Error{
+			Code:   CodeArticleVersionMismatch,
+			Detail: "The blog post was modified since it was read, fetch it again before saving your changes.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrNotArticleAuthor {
+		statusMessage := Error{
+			Code:   CodeNotArticleAuthor,
+			Detail: "Only the author of this blog post, an editor or an admin can modify it.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	response.Header().Set("ETag", article.etag())
 	statusCode := http.StatusOK
-	statusMessage := SuccessJSONGenerator(http.StatusText(statusCode), customMessage)
-	ReturnSuccessfulResponse(response, statusCode, statusMessage)
+	statusMessage := Envelope{Data: article}
+	writeResponse(response, request, statusCode, statusMessage)
 }
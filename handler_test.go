@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestArticleLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+
+		article := server.createArticle(token, "First post", "Hello")
+		if article.ID == "" || article.Title != "First post" || article.Status != StatusPublished {
+			t.Fatalf("unexpected article %+v", article)
+		}
+
+		recorder := server.do(http.MethodGet, "/v1/articles/"+article.ID, token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		read := &Article{}
+		decodeData(t, recorder, read)
+		if read.ID != article.ID || read.Content != "Hello" {
+			t.Fatalf("read %+v, expected %+v", read, article)
+		}
+
+		update := map[string]string{"title": "First post", "content": "Hello again"}
+		recorder = server.do(http.MethodPut, "/v1/articles/"+article.ID, token, update)
+		expectStatus(t, recorder, http.StatusOK)
+		recorder = server.do(http.MethodGet, "/v1/articles/"+article.ID, token, nil)
+		decodeData(t, recorder, read)
+		if read.Content != "Hello again" {
+			t.Fatalf("expected the updated content, got %q", read.Content)
+		}
+
+		recorder = server.do(http.MethodDelete, "/v1/articles/"+article.ID, token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		recorder = server.do(http.MethodGet, "/v1/articles/"+article.ID, token, nil)
+		expectProblem(t, recorder, http.StatusNotFound, CodeArticleNotFound)
+	})
+}
+
+func TestArticlesRequireToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		recorder := server.do(http.MethodGet, "/v1/articles", "", nil)
+		expectProblem(t, recorder, http.StatusUnauthorized, CodeAuthTokenMissing)
+	})
+}
+
+func TestOnlyAuthorModifiesArticle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		author := server.login("author@example.com").AccessToken
+		other := server.login("other@example.com").AccessToken
+		article := server.createArticle(author, "Mine", "Hands off")
+
+		update := map[string]string{"title": "Theirs", "content": "Taken"}
+		recorder := server.do(http.MethodPut, "/v1/articles/"+article.ID, other, update)
+		expectProblem(t, recorder, http.StatusForbidden, CodeNotArticleAuthor)
+
+		admin := server.login("admin@example.com").AccessToken
+		recorder = server.do(http.MethodPut, "/v1/articles/"+article.ID, admin, update)
+		expectStatus(t, recorder, http.StatusOK)
+	})
+}
+
+func TestCreatedArticleDefaultStatus(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		input := map[string]string{"title": "Untitled", "content": "content"}
+
+		for path, want := range map[string]ArticleStatus{
+			"/v1/articles": StatusDraft,
+			// the legacy route publishes, as it did before drafts existed
+			"/blogs/create": StatusPublished,
+		} {
+			recorder := server.do(http.MethodPost, path, token, input)
+			expectStatus(t, recorder, http.StatusCreated)
+			article := &Article{}
+			decodeData(t, recorder, article)
+			if article.Status != want {
+				t.Errorf("%s: expected a %s article, got %s", path, want, article.Status)
+			}
+		}
+
+		input["status"] = string(StatusDraft)
+		recorder := server.do(http.MethodPost, "/blogs/create", token, input)
+		expectStatus(t, recorder, http.StatusCreated)
+		article := &Article{}
+		decodeData(t, recorder, article)
+		if article.Status != StatusDraft {
+			t.Errorf("expected the legacy route to keep the given status, got %s", article.Status)
+		}
+	})
+}
+
+func TestDeleteHidesUnpublishedArticlesOfOthers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		author := server.login("author@example.com").AccessToken
+		other := server.login("other@example.com").AccessToken
+		input := map[string]string{"title": "Draft", "content": "content", "status": string(StatusDraft)}
+		recorder := server.do(http.MethodPost, "/v1/articles", author, input)
+		expectStatus(t, recorder, http.StatusCreated)
+		draft := &Article{}
+		decodeData(t, recorder, draft)
+
+		// deleting reveals no more than reading does
+		expectProblem(t, server.do(http.MethodGet, "/v1/articles/"+draft.ID, other, nil), http.StatusNotFound, CodeArticleNotFound)
+		expectProblem(t, server.do(http.MethodDelete, "/v1/articles/"+draft.ID, other, nil), http.StatusNotFound, CodeArticleNotFound)
+
+		published := server.createArticle(author, "Published", "content")
+		expectProblem(t, server.do(http.MethodDelete, "/v1/articles/"+published.ID, other, nil), http.StatusForbidden, CodeNotArticleAuthor)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Identity is the authenticated user making a request, placed into the request context by verifyToken
+type Identity struct {
+	UserID string
+	Email  string
+	Role   Role
+	// TokenID is the jti of the access token the user authenticated with
+	TokenID string
+	// SessionID is the refresh token family the access token belongs to, it is empty for Firebase ID tokens
+	SessionID      string
+	TokenIssuedAt  time.Time
+	TokenExpiresAt time.Time
+}
+
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
+// withIdentity returns a copy of ctx carrying identity
+func withIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey, identity)
+}
+
+// identityFromContext returns the identity placed into ctx by verifyToken, or nil for anonymous requests
+func identityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey).(*Identity)
+	return identity
+}
+
+// isAdminEmail reports whether email is listed inside ADMIN_EMAILS, whose users are always admins
+// so that roles can be managed before anyone was given the admin role
+func isAdminEmail(email string) bool {
+	for _, adminEmail := range strings.Split(env.AdminEmails, ",") {
+		if adminEmail = strings.TrimSpace(adminEmail); adminEmail != "" && strings.EqualFold(adminEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// canModify reports whether the identity may update or delete article, which only its author, editors and admins may do
+func (identity *Identity) canModify(article *Article) bool {
+	if identity == nil {
+		return false
+	}
+	if identity.Role.includes(RoleEditor) {
+		return true
+	}
+	return identity.Role.includes(RoleAuthor) && article.AuthorID != "" && article.AuthorID == identity.UserID
+}
+
+// canView reports whether the identity may read article, which everyone may do once it is published
+func (identity *Identity) canView(article *Article) bool {
+	return article.Status == StatusPublished || identity.canModify(article)
+}
+
+// seesEveryAuthor reports whether the identity may list unpublished articles of every author instead of only their own
+func (identity *Identity) seesEveryAuthor() bool {
+	return identity != nil && identity.Role.includes(RoleEditor)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxRequestBodyBytes limits the size of every request body read by decodeInput and readRequestBody
+const maxRequestBodyBytes = 1 << 20
+
+// ErrUnsupportedMediaType is returned for request bodies which are not sent as JSON, URL encoded or multipart form
+var ErrUnsupportedMediaType = errors.New("the request body must be sent as application/json, application/x-www-form-urlencoded or multipart/form-data")
+
+// ErrRequestBodyTooLarge is returned for request bodies larger than maxRequestBodyBytes
+var ErrRequestBodyTooLarge = errors.New("the request body must not be larger than " + strconv.Itoa(maxRequestBodyBytes) + " bytes")
+
+// InputError describes a request body which could be read but holds invalid input
+type InputError struct {
+	Field  string
+	Reason string
+}
+
+func (err *InputError) Error() string {
+	if err.Field == "" {
+		return "invalid request body: " + err.Reason
+	}
+	return fmt.Sprintf("invalid request body: field %s %s", err.Field, err.Reason)
+}
+
+// readRequestBody reads the whole request body, or returns ErrRequestBodyTooLarge
+func readRequestBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRequestBodyBytes {
+		return nil, ErrRequestBodyTooLarge
+	}
+	return body, nil
+}
+
+// decodeInput reads the fields of a request body sent as a JSON object of strings, a URL encoded form or a multipart form,
+// chosen by its Content-Type. Fields other than the allowed ones are rejected, and so are uploaded files.
+// Unlike request.Form, query parameters are never mixed into the input.
+func decodeInput(request *http.Request, allowed ...string) (url.Values, error) {
+	body, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" && len(bytes.TrimSpace(body)) == 0 {
+		return url.Values{}, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	var input url.Values
+	switch mediaType {
+	case "application/json":
+		input, err = decodeJSONInput(body)
+	case "application/x-www-form-urlencoded":
+		input, err = url.ParseQuery(string(body))
+		if err != nil {
+			err = &InputError{Reason: "the form is malformed"}
+		}
+	case "multipart/form-data":
+		input, err = decodeMultipartInput(body, params["boundary"])
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	isAllowed := map[string]bool{}
+	for _, field := range allowed {
+		isAllowed[field] = true
+	}
+	for field := range input {
+		if !isAllowed[field] {
+			return nil, &InputError{Field: field, Reason: "is unknown"}
+		}
+	}
+	return input, nil
+}
+
+// decodeJSONInput reads a JSON object whose members are strings, null members are treated as missing
+func decodeJSONInput(body []byte) (url.Values, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, &InputError{Reason: "must be a JSON object"}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, &InputError{Reason: "must hold a single JSON object"}
+	}
+
+	input := url.Values{}
+	for field, value := range object {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			input.Set(field, value)
+		default:
+			return nil, &InputError{Field: field, Reason: "must be a string"}
+		}
+	}
+	return input, nil
+}
+
+// decodeMultipartInput reads the values of a multipart form, which must not upload any file
+func decodeMultipartInput(body []byte, boundary string) (url.Values, error) {
+	if boundary == "" {
+		return nil, &InputError{Reason: "the multipart form has no boundary"}
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), boundary).ReadForm(maxRequestBodyBytes)
+	if err != nil {
+		return nil, &InputError{Reason: "the multipart form is malformed"}
+	}
+	defer form.RemoveAll()
+	for field := range form.File {
+		return nil, &InputError{Field: field, Reason: "must not be a file"}
+	}
+	return url.Values(form.Value), nil
+}
+
+// missingFields lists the fields which are required but missing from input
+func missingFields(input url.Values, required ...string) []FieldError {
+	var missing []FieldError
+	for _, field := range required {
+		if _, ok := input[field]; !ok {
+			missing = append(missing, FieldError{Field: field, Reason: "is required"})
+		}
+	}
+	return missing
+}
+
+// exitWithInputError responds with the error returned by decodeInput or readRequestBody
+func exitWithInputError(response http.ResponseWriter, err error) {
+	statusMessage := Error{
+		Code:   CodeMalformedRequest,
+		Detail: err.Error(),
+	}
+	if inputErr, ok := err.(*InputError); ok && inputErr.Field != "" {
+		statusMessage.Code = CodeValidationFailed
+		statusMessage.Errors = []FieldError{{Field: inputErr.Field, Reason: inputErr.Reason}}
+	}
+	switch err {
+	case ErrUnsupportedMediaType:
+		statusMessage.Code = CodeUnsupportedMediaType
+	case ErrRequestBodyTooLarge:
+		statusMessage.Code = CodeRequestBodyTooLarge
+	}
+	ExitWithError(response, statusMessage)
+}
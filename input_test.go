@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// multipartBody encodes fields, and a file named upload when given, as a multipart form and returns it with its Content-Type
+func multipartBody(t *testing.T, fields map[string]string, upload string) (string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, value := range fields {
+		if err := writer.WriteField(field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upload != "" {
+		file, err := writer.CreateFormFile(upload, "upload.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte("file content"))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return body.String(), writer.FormDataContentType()
+}
+
+func TestArticleInputFormats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		fields := map[string]string{"title": "Title", "content": "content", "status": string(StatusPublished)}
+		form := url.Values{}
+		for field, value := range fields {
+			form.Set(field, value)
+		}
+		multipartForm, multipartContentType := multipartBody(t, fields, "")
+
+		for _, test := range []struct {
+			name, body, contentType string
+		}{
+			{"json", `{"title": "Title", "content": "content", "status": "published", "publish_at": null}`, "application/json; charset=utf-8"},
+			{"urlencoded", form.Encode(), "application/x-www-form-urlencoded"},
+			{"multipart", multipartForm, multipartContentType},
+		} {
+			recorder := server.do(http.MethodPost, "/v1/articles", token, test.body, "Content-Type", test.contentType)
+			expectStatus(t, recorder, http.StatusCreated)
+			article := &Article{}
+			decodeData(t, recorder, article)
+			if article.Title != "Title" || article.Content != "content" || article.Status != StatusPublished {
+				t.Errorf("%s: unexpected article %+v", test.name, article)
+			}
+		}
+	})
+}
+
+func TestArticleInputIsRejected(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		withFile, withFileContentType := multipartBody(t, map[string]string{"title": "Title", "content": "content"}, "content")
+		oversized := `{"title": "Title", "content": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`
+
+		for _, test := range []struct {
+			name, body, contentType string
+			status                  int
+			code                    ErrorCode
+		}{
+			{"unknown field", `{"title": "Title", "content": "content", "author": "someone"}`, "application/json", http.StatusBadRequest, CodeValidationFailed},
+			{"number", `{"title": "Title", "content": 1}`, "application/json", http.StatusBadRequest, CodeValidationFailed},
+			{"array", `["title", "content"]`, "application/json", http.StatusBadRequest, CodeMalformedRequest},
+			{"two objects", `{"title": "Title"} {"content": "content"}`, "application/json", http.StatusBadRequest, CodeMalformedRequest},
+			{"file", withFile, withFileContentType, http.StatusBadRequest, CodeValidationFailed},
+			{"multipart without boundary", withFile, "multipart/form-data", http.StatusBadRequest, CodeMalformedRequest},
+			{"unsupported type", "title=Title", "text/plain", http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+			{"missing type", "title=Title", "", http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+			{"oversized", oversized, "application/json", http.StatusRequestEntityTooLarge, CodeRequestBodyTooLarge},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				recorder := server.do(http.MethodPost, "/v1/articles", token, test.body, "Content-Type", test.contentType)
+				expectProblem(t, recorder, test.status, test.code)
+			})
+		}
+
+		recorder := server.do(http.MethodGet, "/v1/articles", token, nil)
+		var articles []*Article
+		decodeData(t, recorder, &articles)
+		if len(articles) != 0 {
+			t.Fatalf("expected rejected input to create no article, got %+v", articles)
+		}
+	})
+}
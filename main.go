@@ -2,68 +2,100 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	firebase "firebase.google.com/go"
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/option"
 )
 
-// LoadEnvFileAndReturnEnvVarValueByKey returns value of given variable inside .env
+// LoadEnvFileAndReturnEnvVarValueByKey returns value of given variable inside .env,
+// or of the environment when there is no .env file
 func LoadEnvFileAndReturnEnvVarValueByKey(key string) string {
 	err := godotenv.Load(".env")
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		log.Fatalf("Error loading .env file")
 	}
 	return os.Getenv(key)
 }
 
-// Error is a structure which holds message for error in string json format
-type Error struct {
-	Message       string `json:"message"`
-	CustomMessage string `json:"custom_message,omitempty"`
-}
-
 // Env holds global environment variable to configure environment within this app
 type Env struct {
 	Port              int
 	FirebaseProjectID string
-	JwtHashKey        string
+	// JwtHashKey is the HS256 secret tokens are signed with unless JwtSigningKeys is set, and which keeps verifying
+	// tokens without a kid header as long as it is set
+	JwtHashKey string
+	// JwtSigningKeys is a comma separated list of PEM encoded RSA, P-256 or Ed25519 private key files. The first key
+	// signs new tokens while every key verifies them and is published at /.well-known/jwks.json. A key is rotated in
+	// by appending it, moving it first once verifiers had time to fetch it, and removing the old key after accessTokenTTL.
+	JwtSigningKeys string
+	// StorageBackend selects where articles and users are stored: "firestore" (default), "sqlite" or "memory"
+	StorageBackend string
+	// SQLitePath is the database file used by the "sqlite" storage backend
+	SQLitePath string
+	// AdminEmails is a comma separated list of users who are always admins, regardless of their stored role
+	AdminEmails string
+	// PublishSchedulerInterval is how often scheduled drafts are checked for publication, as a duration like "30s"
+	PublishSchedulerInterval string
+	// CacheControlPublic is the Cache-Control header of responses holding published articles
+	CacheControlPublic string
+	// CacheControlPrivate is the Cache-Control header of responses holding drafts or archived articles
+	CacheControlPrivate string
+	// TrashRetention is how long deleted articles stay inside the trash before they are permanently deleted, like "720h"
+	TrashRetention string
+	// TrashPurgeInterval is how often the trash is checked for articles past the retention period, like "1h"
+	TrashPurgeInterval string
+	// RefreshTokenTTL is how long a refresh token returned by a login or a refresh can be exchanged, like "720h"
+	RefreshTokenTTL string
+	// RevocationGCInterval is how often revocations of tokens which expired since are deleted, like "1h"
+	RevocationGCInterval string
 }
 
-// ExitWithError exits from a function when any type of err was caught during http communication
-func ExitWithError(response http.ResponseWriter, statusCode int, statusMessage Error) {
-	response.WriteHeader(statusCode)
-	json.NewEncoder(response).Encode(statusMessage)
-}
-
-// ReturnSuccessfulResponse returns a success message to the client
-func ReturnSuccessfulResponse(response http.ResponseWriter, statusCode int, statusMessage map[string]interface{}) {
-	response.WriteHeader(statusCode)
-	json.NewEncoder(response).Encode(statusMessage)
-}
-
-// SuccessJSONGenerator is a factory to generate message when job is successfully finished over http connection
-func SuccessJSONGenerator(msgVal, dataVal interface{}) map[string]interface{} {
-	return map[string]interface{}{
-		"Message": msgVal,
-		"Data":    dataVal,
+var env = Env{
+	Port:                     8081,
+	FirebaseProjectID:        LoadEnvFileAndReturnEnvVarValueByKey("FIREBASE_PROJECT_ID"),
+	JwtHashKey:               LoadEnvFileAndReturnEnvVarValueByKey("JWT_HASH_KEY"),
+	JwtSigningKeys:           LoadEnvFileAndReturnEnvVarValueByKey("JWT_SIGNING_KEYS"),
+	StorageBackend:           LoadEnvFileAndReturnEnvVarValueByKey("STORAGE_BACKEND"),
+	SQLitePath:               LoadEnvFileAndReturnEnvVarValueByKey("SQLITE_PATH"),
+	AdminEmails:              LoadEnvFileAndReturnEnvVarValueByKey("ADMIN_EMAILS"),
+	PublishSchedulerInterval: LoadEnvFileAndReturnEnvVarValueByKey("PUBLISH_SCHEDULER_INTERVAL"),
+	CacheControlPublic:       LoadEnvFileAndReturnEnvVarValueByKey("CACHE_CONTROL_PUBLIC"),
+	CacheControlPrivate:      LoadEnvFileAndReturnEnvVarValueByKey("CACHE_CONTROL_PRIVATE"),
+	TrashRetention:           LoadEnvFileAndReturnEnvVarValueByKey("TRASH_RETENTION"),
+	TrashPurgeInterval:       LoadEnvFileAndReturnEnvVarValueByKey("TRASH_PURGE_INTERVAL"),
+	RefreshTokenTTL:          LoadEnvFileAndReturnEnvVarValueByKey("REFRESH_TOKEN_TTL"),
+	RevocationGCInterval:     LoadEnvFileAndReturnEnvVarValueByKey("REVOCATION_GC_INTERVAL")}
+
+// durationSetting parses the duration held by an environment variable, or returns fallback when it is not set
+func durationSetting(key, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("%s must be a positive duration like 30s or 5m, got %q\n", key, value)
 	}
+	return duration
 }
 
-var env = Env{
-	Port:              8081,
-	FirebaseProjectID: LoadEnvFileAndReturnEnvVarValueByKey("FIREBASE_PROJECT_ID"),
-	JwtHashKey:        LoadEnvFileAndReturnEnvVarValueByKey("JWT_HASH_KEY")}
-
-func main() {
+// Storage holds the stores selected by STORAGE_BACKEND
+type Storage struct {
+	Articles ArticleStore
+	Users    UserStore
+	Tokens   TokenStore
+	// AuthClient is only available when users are stored inside Firebase
+	AuthClient AuthClient
+	Close      func() error
+}
 
-	ctx := context.Background()
+// initFirebaseStorage connects to the Firebase project of the service account
+func initFirebaseStorage(ctx context.Context) *Storage {
 	sa := option.WithCredentialsFile("yurie-s-go-api-firebase-adminsdk-qzfyx-d2587d9fd3.json")
 	app, err := firebase.NewApp(ctx, nil, sa)
 	if err != nil {
@@ -80,21 +112,79 @@ func main() {
 		log.Fatalf("error getting Auth client: %v\n", err)
 	}
 
-	blogs := initBlogs(firestoreClient)
-	users := initUsers(firestoreClient, authClient)
+	return &Storage{
+		Articles:   initFirestoreArticleStore(firestoreClient),
+		Users:      initFirestoreUserStore(firestoreClient),
+		Tokens:     initFirestoreTokenStore(firestoreClient),
+		AuthClient: firebaseAuthClient{authClient},
+		Close:      firestoreClient.Close,
+	}
+}
 
-	router := mux.NewRouter()
+// initStorage returns the stores selected by STORAGE_BACKEND
+func initStorage(ctx context.Context) *Storage {
+	switch env.StorageBackend {
+	case "memory":
+		log.Println("Storing articles and users in memory, they will be lost on shutdown")
+		return &Storage{
+			Articles: initMemoryArticleStore(),
+			Users:    initMemoryUserStore(),
+			Tokens:   initMemoryTokenStore(),
+			Close:    func() error { return nil },
+		}
+	case "sqlite":
+		path := env.SQLitePath
+		if path == "" {
+			path = "blogs.db"
+		}
+		store, err := initSQLiteStore(path)
+		if err != nil {
+			log.Fatalf("error opening SQLite database %s: %v\n", path, err)
+		}
+		return &Storage{Articles: store, Users: store, Tokens: store, Close: store.Close}
+	case "", "firestore":
+		return initFirebaseStorage(ctx)
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q\n", env.StorageBackend)
+		return nil
+	}
+}
 
-	router.HandleFunc("/", HelloWorld).Methods("GET")
-	router.HandleFunc("/signup", users.Signup)
-	router.HandleFunc("/login", users.Login)
-	router.HandleFunc("/blogs", users.verifyToken(blogs.ListAllArticlesHandler))
-	router.HandleFunc("/blogs/create", users.verifyToken(blogs.PublishArticleHandler))
-	router.HandleFunc("/blogs/{id}", users.verifyToken(blogs.ListArticleHandler))
-	router.HandleFunc("/blogs/delete/{id}", users.verifyToken(blogs.DeleteArticleHandler))
-	router.HandleFunc("/blogs/update/{id}", users.verifyToken(blogs.UpdateArticleHandler))
+func main() {
+	storage := initStorage(context.Background())
+	defer storage.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(storage, os.Args[2:]); err != nil {
+			log.Fatalf("error migrating storage: %v\n", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcileCommand(storage, os.Args[2:]); err != nil {
+			log.Fatalf("error reconciling users: %v\n", err)
+		}
+		return
+	}
+	warnAboutPendingMigrations(context.Background(), storage)
 
-	defer firestoreClient.Close()
+	blogs := initBlogs(storage.Articles)
+	keys, err := initKeySet(env.JwtSigningKeys, env.JwtHashKey)
+	if err != nil {
+		log.Fatalf("error loading JWT signing keys: %v\n", err)
+	}
+	users := initUsers(storage.Users, storage.Tokens, storage.AuthClient, keys,
+		durationSetting("REFRESH_TOKEN_TTL", env.RefreshTokenTTL, defaultRefreshTokenTTL))
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go blogs.runPublishScheduler(schedulerCtx, durationSetting("PUBLISH_SCHEDULER_INTERVAL", env.PublishSchedulerInterval, defaultPublishSchedulerInterval))
+	go blogs.runTrashPurger(schedulerCtx,
+		durationSetting("TRASH_PURGE_INTERVAL", env.TrashPurgeInterval, defaultTrashPurgeInterval),
+		durationSetting("TRASH_RETENTION", env.TrashRetention, defaultTrashRetention))
+	go users.runRevocationCollector(schedulerCtx, durationSetting("REVOCATION_GC_INTERVAL", env.RevocationGCInterval, defaultRevocationGCInterval))
+
+	router := initRouter(blogs, users)
 
 	log.Println("Listening...")
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", env.Port), router))
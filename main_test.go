@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// testPassword is the password of every user signed up by the tests
+const testPassword = "correct horse battery staple"
+
+// testServer serves the router of main with the stores of a storage backend
+type testServer struct {
+	t      *testing.T
+	router *mux.Router
+	blogs  *Blogs
+	users  *Users
+}
+
+// testBackends lists the storage backends the handler tests run against, each opening empty stores
+var testBackends = []struct {
+	name string
+	open func(t *testing.T) (ArticleStore, UserStore, TokenStore)
+}{
+	{"memory", func(t *testing.T) (ArticleStore, UserStore, TokenStore) {
+		return initMemoryArticleStore(), initMemoryUserStore(), initMemoryTokenStore()
+	}},
+	{"sqlite", func(t *testing.T) (ArticleStore, UserStore, TokenStore) {
+		store := openTestSQLiteStore(t)
+		return store, store, store
+	}},
+}
+
+// openTestSQLiteStore opens a SQLite store in a temporary directory, which is removed when the test ends
+func openTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := initSQLiteStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// forEachBackend runs test as a subtest against a server of every backend of testBackends
+func forEachBackend(t *testing.T, test func(t *testing.T, server *testServer)) {
+	for _, backend := range testBackends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			articles, users, tokens := backend.open(t)
+			test(t, newTestServerWithStores(t, articles, users, tokens, nil))
+		})
+	}
+}
+
+// newTestServer returns a server with in-memory stores, signing tokens with keys or with an HS256 secret when keys is nil
+func newTestServer(t *testing.T, keys *KeySet) *testServer {
+	t.Helper()
+	return newTestServerWithStores(t, initMemoryArticleStore(), initMemoryUserStore(), initMemoryTokenStore(), keys)
+}
+
+// newTestServerWithStores returns a server keeping its data in the given stores, signing tokens like newTestServer
+func newTestServerWithStores(t *testing.T, articles ArticleStore, userStore UserStore, tokens TokenStore, keys *KeySet) *testServer {
+	t.Helper()
+	if keys == nil {
+		var err error
+		keys, err = initKeySet("", "test-secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	adminEmails := env.AdminEmails
+	env.AdminEmails = "admin@example.com"
+	t.Cleanup(func() { env.AdminEmails = adminEmails })
+
+	blogs := initBlogs(articles)
+	users := initUsers(userStore, tokens, nil, keys, defaultRefreshTokenTTL)
+	return &testServer{t: t, router: initRouter(blogs, users), blogs: blogs, users: users}
+}
+
+// do sends a request with body encoded as JSON unless it is a string, and headers given as name, value pairs
+func (server *testServer) do(method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	server.t.Helper()
+	var reader *bytes.Reader
+	switch body := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(body))
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			server.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expectStatus fails the test unless the response has the status code want
+func expectStatus(t *testing.T, recorder *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if recorder.Code != want {
+		t.Fatalf("expected status %d, got %d: %s", want, recorder.Code, recorder.Body.String())
+	}
+}
+
+// expectProblem fails the test unless the response is a problem with the status code and error code want
+func expectProblem(t *testing.T, recorder *httptest.ResponseRecorder, status int, code ErrorCode) {
+	t.Helper()
+	expectStatus(t, recorder, status)
+	var problem Error
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decoding problem %s: %v", recorder.Body.String(), err)
+	}
+	if problem.Code != code {
+		t.Fatalf("expected error code %q, got %q: %s", code, problem.Code, recorder.Body.String())
+	}
+}
+
+// decodeData decodes the data of an envelope into data and returns the rest of the envelope
+func decodeData(t *testing.T, recorder *httptest.ResponseRecorder, data interface{}) Envelope {
+	t.Helper()
+	envelope := Envelope{Data: data}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decoding envelope %s: %v", recorder.Body.String(), err)
+	}
+	return envelope
+}
+
+// login signs up a user with email unless it exists already, and logs it in
+func (server *testServer) login(email string) *TokenPair {
+	server.t.Helper()
+	credentials := map[string]string{"email": email, "password": testPassword}
+	recorder := server.do(http.MethodPost, "/v1/users", "", credentials)
+	if recorder.Code != http.StatusCreated && recorder.Code != http.StatusConflict {
+		server.t.Fatalf("signing up %s: %d %s", email, recorder.Code, recorder.Body.String())
+	}
+	recorder = server.do(http.MethodPost, "/v1/sessions", "", credentials)
+	expectStatus(server.t, recorder, http.StatusOK)
+	tokens := &TokenPair{}
+	decodeData(server.t, recorder, tokens)
+	return tokens
+}
+
+// createArticle publishes an article as the user of token
+func (server *testServer) createArticle(token, title, content string) *Article {
+	server.t.Helper()
+	input := map[string]string{"title": title, "content": content, "status": string(StatusPublished)}
+	recorder := server.do(http.MethodPost, "/v1/articles", token, input)
+	expectStatus(server.t, recorder, http.StatusCreated)
+	article := &Article{}
+	decodeData(server.t, recorder, article)
+	// stores order articles by their creation time, which must differ between articles
+	time.Sleep(time.Millisecond)
+	return article
+}
+
+// expectBackgroundJob runs job until done reports it did its work, failing the test unless it does within a second
+func expectBackgroundJob(t *testing.T, job func(ctx context.Context), done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		job(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if done() {
+			return
+		}
+	}
+	t.Fatal("the background job did not finish its work within a second")
+}
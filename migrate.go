@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Migration is a single versioned change of the documents stored by a storage backend.
+// Each function must be safe to run again on documents it already migrated.
+type Migration struct {
+	Version     int
+	Description string
+	// Firestore migrates the collections of a Firestore database
+	Firestore func(ctx context.Context, db *firestore.Client) error
+	// SQLite migrates the tables of a SQLite database inside the transaction recording the migration
+	SQLite func(ctx context.Context, tx *sql.Tx) error
+}
+
+// AppliedMigration records when a migration was applied to a storage backend
+type AppliedMigration struct {
+	Version     int
+	Description string
+	AppliedAt   time.Time
+}
+
+// Migrator is implemented by stores which record applied migrations and know how to apply new ones
+type Migrator interface {
+	// AppliedMigrations returns every migration recorded as applied, keyed by version
+	AppliedMigrations(ctx context.Context) (map[int]AppliedMigration, error)
+	// ApplyMigration runs a migration and records it as applied
+	ApplyMigration(ctx context.Context, migration Migration) error
+}
+
+// migrations lists every migration in the order they must be applied. Versions must never be reused.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "convert created_at and modified_at of blogs from strings to native timestamps",
+		Firestore:   migrateFirestoreArticleTimestamps,
+		SQLite:      migrateSQLiteArticleTimestamps,
+	},
+	{
+		Version:     2,
+		Description: "set modified_at of never updated blogs to created_at, so they can be sorted by modified_at",
+		Firestore:   migrateFirestoreArticleModifiedAt,
+		SQLite: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE blogs SET modified_at = created_at WHERE modified_at IS NULL")
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "mark blogs written before statuses existed as published at their creation time",
+		Firestore:   migrateFirestoreArticleStatus,
+		SQLite: func(ctx context.Context, tx *sql.Tx) error {
+			// the status column defaults to published, only published_at is missing
+			_, err := tx.ExecContext(ctx, "UPDATE blogs SET published_at = created_at WHERE status = 'published' AND published_at IS NULL")
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "mark blogs written before the trash existed as not trashed, so they can be filtered on it",
+		Firestore:   migrateFirestoreArticleTrashed,
+		// SQLite filters on deleted_at being NULL, which it already is
+	},
+	{
+		Version:     5,
+		Description: "store the emails of users in lower case, like signups do, so that they are found case insensitively",
+		Firestore:   migrateFirestoreUserEmails,
+		SQLite: func(ctx context.Context, tx *sql.Tx) error {
+			// the email column compares case insensitively already, so no two users end up with the same email,
+			// and telling the cases apart takes the binary collation
+			_, err := tx.ExecContext(ctx, "UPDATE users SET email = lower(email) WHERE email <> lower(email) COLLATE BINARY")
+			return err
+		},
+	},
+}
+
+// pendingMigrations returns the migrations not yet applied, ordered by version
+func pendingMigrations(ctx context.Context, migrator Migrator) ([]Migration, error) {
+	applied, err := migrator.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+	return pending, nil
+}
+
+// runMigrations applies every pending migration in order and stops at the first failure
+func runMigrations(ctx context.Context, migrator Migrator) error {
+	pending, err := pendingMigrations(ctx, migrator)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		log.Println("No pending migrations")
+		return nil
+	}
+
+	for _, migration := range pending {
+		log.Printf("Applying migration %d: %s\n", migration.Version, migration.Description)
+		if err := migrator.ApplyMigration(ctx, migration); err != nil {
+			return fmt.Errorf("migration %d failed: %v", migration.Version, err)
+		}
+	}
+	log.Printf("Applied %d migration(s)\n", len(pending))
+	return nil
+}
+
+// printMigrationStatus lists every known migration and whether it was applied
+func printMigrationStatus(ctx context.Context, migrator Migrator) error {
+	applied, err := migrator.AppliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		state := "pending"
+		if record, ok := applied[migration.Version]; ok {
+			state = "applied " + record.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-28s  %s\n", migration.Version, state, migration.Description)
+	}
+	return nil
+}
+
+// warnAboutPendingMigrations logs a reminder to run the "migrate" subcommand when the storage is outdated
+func warnAboutPendingMigrations(ctx context.Context, storage *Storage) {
+	migrator, ok := storage.Articles.(Migrator)
+	if !ok {
+		return
+	}
+	pending, err := pendingMigrations(ctx, migrator)
+	if err != nil {
+		log.Printf("error checking for pending migrations: %v\n", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Printf("%d migration(s) pending, run the \"migrate\" subcommand to apply them\n", len(pending))
+	}
+}
+
+// runMigrateCommand implements the "migrate" subcommand: "migrate" applies pending migrations, "migrate status" lists them
+func runMigrateCommand(storage *Storage, args []string) error {
+	migrator, ok := storage.Articles.(Migrator)
+	if !ok {
+		log.Printf("The %q storage backend keeps nothing to migrate\n", env.StorageBackend)
+		return nil
+	}
+
+	ctx := context.Background()
+	if len(args) == 0 {
+		return runMigrations(ctx, migrator)
+	}
+	switch args[0] {
+	case "up":
+		return runMigrations(ctx, migrator)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected \"up\" or \"status\"", args[0])
+	}
+}
+
+// legacyTimestampLayout is the layout of time.Time.String(), which was used to store created_at and modified_at
+const legacyTimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// parseLegacyTimestamp parses a timestamp stored as time.Now().String()
+func parseLegacyTimestamp(value string) (time.Time, error) {
+	// time.Now().String() appends the monotonic clock reading, which has no meaning once stored
+	if index := strings.Index(value, " m="); index >= 0 {
+		value = value[:index]
+	}
+	parsed, err := time.Parse(legacyTimestampLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.UTC(), nil
+}
+
+// updateFirestoreDocuments applies the updates returned by update to every document matched by query, in write batches
+func updateFirestoreDocuments(ctx context.Context, db *firestore.Client, query firestore.Query, update func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error)) error {
+	// a write batch accepts at most 500 writes
+	const batchSize = 500
+
+	batch := db.Batch()
+	batched := 0
+	docSnapshotIter := query.Documents(ctx)
+	defer docSnapshotIter.Stop()
+	for {
+		doc, err := docSnapshotIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		updates, err := update(doc)
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		batch.Update(doc.Ref, updates)
+		batched++
+		if batched == batchSize {
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch = db.Batch()
+			batched = 0
+		}
+	}
+
+	if batched > 0 {
+		_, err := batch.Commit(ctx)
+		return err
+	}
+	return nil
+}
+
+// migrateFirestoreArticleTimestamps rewrites string created_at and modified_at fields of the "blogs" collection as timestamps
+func migrateFirestoreArticleTimestamps(ctx context.Context, db *firestore.Client) error {
+	return updateFirestoreDocuments(ctx, db, db.Collection("blogs").Query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		var updates []firestore.Update
+		for _, field := range []string{"created_at", "modified_at"} {
+			value, isString := doc.Data()[field].(string)
+			if !isString {
+				continue
+			}
+			if value == "" {
+				updates = append(updates, firestore.Update{Path: field, Value: firestore.Delete})
+				continue
+			}
+			timestamp, err := parseLegacyTimestamp(value)
+			if err != nil {
+				return nil, fmt.Errorf("document %s has invalid %s: %v", doc.Ref.ID, field, err)
+			}
+			updates = append(updates, firestore.Update{Path: field, Value: timestamp})
+		}
+		return updates, nil
+	})
+}
+
+// migrateFirestoreArticleModifiedAt copies created_at into modified_at of every document of the "blogs" collection missing it
+func migrateFirestoreArticleModifiedAt(ctx context.Context, db *firestore.Client) error {
+	return updateFirestoreDocuments(ctx, db, db.Collection("blogs").Query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		data := doc.Data()
+		if data["modified_at"] != nil {
+			return nil, nil
+		}
+		return []firestore.Update{{Path: "modified_at", Value: data["created_at"]}}, nil
+	})
+}
+
+// migrateSQLiteArticleTimestamps rewrites created_at and modified_at of the blogs table in sqliteTimestampLayout,
+// which SQLite compares chronologically and the driver reads as timestamps
+func migrateSQLiteArticleTimestamps(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT "+sqliteArticleColumns+" FROM blogs")
+	if err != nil {
+		return err
+	}
+	var articles []*Article
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		articles = append(articles, article)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, article := range articles {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE blogs SET created_at = ?, modified_at = ? WHERE id = ?",
+			sqliteTimestamp(article.CreatedAt), sqliteNullTimestamp(article.ModifiedAt), article.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFirestoreArticleStatus marks every document of the "blogs" collection missing a status as published at created_at
+func migrateFirestoreArticleStatus(ctx context.Context, db *firestore.Client) error {
+	return updateFirestoreDocuments(ctx, db, db.Collection("blogs").Query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		data := doc.Data()
+		if data["status"] != nil {
+			return nil, nil
+		}
+		updates := []firestore.Update{{Path: "status", Value: string(StatusPublished)}}
+		if data["published_at"] == nil {
+			updates = append(updates, firestore.Update{Path: "published_at", Value: data["created_at"]})
+		}
+		return updates, nil
+	})
+}
+
+// migrateFirestoreArticleTrashed sets trashed of every document of the "blogs" collection missing it to false
+func migrateFirestoreArticleTrashed(ctx context.Context, db *firestore.Client) error {
+	return updateFirestoreDocuments(ctx, db, db.Collection("blogs").Query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		if _, ok := doc.Data()["trashed"]; ok {
+			return nil, nil
+		}
+		return []firestore.Update{{Path: "trashed", Value: false}}, nil
+	})
+}
+
+// migrateFirestoreUserEmails rewrites the email of every document of the "users" collection in lower case
+func migrateFirestoreUserEmails(ctx context.Context, db *firestore.Client) error {
+	return updateFirestoreDocuments(ctx, db, db.Collection("users").Query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		email, _ := doc.Data()["email"].(string)
+		if email == strings.ToLower(email) {
+			return nil, nil
+		}
+		return []firestore.Update{{Path: "email", Value: strings.ToLower(email)}}, nil
+	})
+}
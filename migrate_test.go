@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sqliteArticleRows reads the stored timestamps of every row of the blogs table, keyed by id
+func sqliteArticleRows(t *testing.T, store *SQLiteStore) map[string][3]string {
+	t.Helper()
+	rows, err := store.db.Query("SELECT id, created_at, IFNULL(modified_at, ''), IFNULL(published_at, '') FROM blogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	stored := map[string][3]string{}
+	for rows.Next() {
+		var ID string
+		var timestamps [3]string
+		if err := rows.Scan(&ID, &timestamps[0], &timestamps[1], &timestamps[2]); err != nil {
+			t.Fatal(err)
+		}
+		stored[ID] = timestamps
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestSQLiteMigrationsConvertLegacyTimestamps(t *testing.T) {
+	ctx := context.Background()
+	store := openTestSQLiteStore(t)
+	created := time.Now().Add(-time.Hour)
+	modified := created.Add(time.Minute)
+	// rows written before migrations existed kept time.Now().String(), monotonic clock reading included
+	_, err := store.db.Exec(
+		"INSERT INTO blogs (id, title, content, created_at, modified_at) VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, NULL)",
+		"updated", "Updated", "content", created.String(), modified.String(),
+		"untouched", "Untouched", "content", created.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runMigrations(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	migrated := sqliteArticleRows(t, store)
+	want := map[string][3]string{
+		"updated":   {sqliteTimestamp(created), sqliteTimestamp(modified), sqliteTimestamp(created)},
+		"untouched": {sqliteTimestamp(created), sqliteTimestamp(created), sqliteTimestamp(created)},
+	}
+	if !reflect.DeepEqual(migrated, want) {
+		t.Fatalf("expected the timestamps %v, got %v", want, migrated)
+	}
+	article, err := store.Get(ctx, "updated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !article.CreatedAt.Equal(created) || article.ModifiedAt == nil || !article.ModifiedAt.Equal(modified) || article.Status != StatusPublished {
+		t.Fatalf("unexpected migrated article %+v", article)
+	}
+
+	// a second run finds nothing pending, and running every migration again changes nothing
+	if err := runMigrations(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		if migration.SQLite == nil {
+			continue
+		}
+		tx, err := store.db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := migration.SQLite(ctx, tx); err != nil {
+			tx.Rollback()
+			t.Fatalf("running migration %d again: %v", migration.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if again := sqliteArticleRows(t, store); !reflect.DeepEqual(again, want) {
+		t.Fatalf("running the migrations again changed the timestamps to %v", again)
+	}
+	applied, err := store.AppliedMigrations(ctx)
+	if err != nil || len(applied) != len(migrations) {
+		t.Fatalf("expected %d applied migrations, got %v and %v", len(migrations), applied, err)
+	}
+}
+
+func TestSQLiteMigrationsLowerCaseEmails(t *testing.T) {
+	ctx := context.Background()
+	store := openTestSQLiteStore(t)
+	// users signed up before emails were stored in lower case
+	_, err := store.db.Exec("INSERT INTO users (id, email, password) VALUES (?, ?, ?)", "mixed", "Mixed@Example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUser(ctx, &User{GeneratedID: "other", Email: "mixed@example.com", Password: "hash", Role: defaultRole}); err != ErrUserAlreadyExists {
+		t.Fatalf("expected the email to be taken whatever its case, got %v", err)
+	}
+
+	if err := runMigrations(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUserByEmail(ctx, "MIXED@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GeneratedID != "mixed" || user.Email != "mixed@example.com" {
+		t.Fatalf("unexpected migrated user %+v", user)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ResponseFormat is a media type a response body can be encoded as
+type ResponseFormat struct {
+	// Name tells the representations of a resource in different formats apart inside their entity tags
+	Name string
+	// MediaTypes are the media types of the format, the first one is sent as Content-Type and the rest are accepted aliases
+	MediaTypes []string
+	encode     func(value interface{}, pretty bool) ([]byte, error)
+}
+
+// ContentType returns the media type sent as the Content-Type of responses in the format
+func (format ResponseFormat) ContentType() string {
+	return format.MediaTypes[0]
+}
+
+var (
+	jsonFormat    = ResponseFormat{Name: "json", MediaTypes: []string{jsonContentType}, encode: encodeJSON}
+	xmlFormat     = ResponseFormat{Name: "xml", MediaTypes: []string{"application/xml", "text/xml"}, encode: encodeXML}
+	msgpackFormat = ResponseFormat{Name: "msgpack", MediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}, encode: encodeMsgpack}
+	cborFormat    = ResponseFormat{Name: "cbor", MediaTypes: []string{"application/cbor"}, encode: encodeCBOR}
+)
+
+// articleFormats are the formats articles can be read in, ordered by preference for clients accepting several of them equally
+var articleFormats = []ResponseFormat{jsonFormat, xmlFormat, msgpackFormat, cborFormat}
+
+// cborEncMode writes timestamps as tagged RFC 3339 strings, like the other formats show them
+var cborEncMode, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano, TimeTag: cbor.EncTagRequired}.EncMode()
+
+// encodeXML encodes value as an XML document, indented when pretty
+func encodeXML(value interface{}, pretty bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	if pretty {
+		encoder.Indent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+// encodeMsgpack encodes value as MessagePack, naming fields like JSON does. MessagePack has no pretty form.
+func encodeMsgpack(value interface{}, pretty bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodeCBOR encodes value as CBOR, naming fields like JSON does. CBOR has no pretty form.
+func encodeCBOR(value interface{}, pretty bool) ([]byte, error) {
+	return cborEncMode.Marshal(value)
+}
+
+// MarshalXML writes the envelope as a <response> element, listing articles as <article> elements inside <data>
+func (envelope Envelope) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "response"}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	data := envelope.Data
+	if articles, ok := data.([]*Article); ok {
+		data = struct {
+			Articles []*Article `xml:"article"`
+		}{articles}
+	}
+	if err := encoder.EncodeElement(data, xml.StartElement{Name: xml.Name{Local: "data"}}); err != nil {
+		return err
+	}
+	if envelope.Meta != nil {
+		if err := encoder.EncodeElement(envelope.Meta, xml.StartElement{Name: xml.Name{Local: "meta"}}); err != nil {
+			return err
+		}
+	}
+	if envelope.Links != nil {
+		if err := encoder.EncodeElement(envelope.Links, xml.StartElement{Name: xml.Name{Local: "links"}}); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// acceptedRange is a media range listed inside an Accept header, like "application/*;q=0.5"
+type acceptedRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept reads the media ranges of the Accept headers of request, skipping malformed ones
+func parseAccept(request *http.Request) []acceptedRange {
+	var ranges []acceptedRange
+	for _, header := range request.Header.Values("Accept") {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+					continue
+				}
+			}
+			ranges = append(ranges, acceptedRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	return ranges
+}
+
+// specificity returns how closely the media range matches mediaType: 2 for an exact match, 1 for type/*, 0 for */*
+// and -1 when it does not match at all
+func (accepted acceptedRange) specificity(mediaType string) int {
+	if accepted.mediaType == mediaType {
+		return 2
+	}
+	if accepted.mediaType == "*/*" {
+		return 0
+	}
+	if strings.HasSuffix(accepted.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accepted.mediaType, "*")) {
+		return 1
+	}
+	return -1
+}
+
+// quality returns how much the client accepts format, taken from the most specific media range matching it
+func (format ResponseFormat) quality(ranges []acceptedRange) float64 {
+	best := 0.0
+	for _, mediaType := range format.MediaTypes {
+		quality, specificity := 0.0, -1
+		for _, accepted := range ranges {
+			if matched := accepted.specificity(mediaType); matched > specificity {
+				quality, specificity = accepted.quality, matched
+			}
+		}
+		if quality > best {
+			best = quality
+		}
+	}
+	return best
+}
+
+// negotiateFormat picks the format of formats most accepted by the Accept header of request,
+// or reports false when the client accepts none of them. Without an Accept header the first format is picked.
+func negotiateFormat(request *http.Request, formats []ResponseFormat) (ResponseFormat, bool) {
+	ranges := parseAccept(request)
+	if len(ranges) == 0 {
+		return formats[0], true
+	}
+	best, bestQuality := ResponseFormat{}, 0.0
+	for _, format := range formats {
+		if quality := format.quality(ranges); quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// contentTypesOf lists the media types formats are sent as, for error messages
+func contentTypesOf(formats []ResponseFormat) string {
+	var contentTypes []string
+	for _, format := range formats {
+		contentTypes = append(contentTypes, format.ContentType())
+	}
+	return strings.Join(contentTypes, ", ")
+}
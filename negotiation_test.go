@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+)
+
+func TestArticleContentNegotiation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		article := server.createArticle(token, "Negotiated", "content")
+		path := "/v1/articles/" + article.ID
+
+		for _, test := range []struct {
+			accept, contentType, etag string
+		}{
+			{"", jsonContentType, `"1"`},
+			{"application/xml", "application/xml", `"1-xml"`},
+			{"text/xml;q=0.9, application/json;q=0.5", "application/xml", `"1-xml"`},
+			{"application/x-msgpack", "application/msgpack", `"1-msgpack"`},
+			{"application/cbor, */*;q=0.1", "application/cbor", `"1-cbor"`},
+		} {
+			recorder := server.do(http.MethodGet, path, token, nil, "Accept", test.accept)
+			expectStatus(t, recorder, http.StatusOK)
+			if contentType := recorder.Header().Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("Accept %q: expected Content-Type %q, got %q", test.accept, test.contentType, contentType)
+			}
+			if etag := recorder.Header().Get("ETag"); etag != test.etag {
+				t.Errorf("Accept %q: expected ETag %s, got %s", test.accept, test.etag, etag)
+			}
+			if recorder.Header().Get("Vary") != "Accept" {
+				t.Errorf("Accept %q: expected Vary: Accept, got %q", test.accept, recorder.Header().Get("Vary"))
+			}
+		}
+
+		recorder := server.do(http.MethodGet, path, token, nil, "Accept", "application/xml")
+		var document struct {
+			Data Article `xml:"data"`
+		}
+		if err := xml.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+			t.Fatal(err)
+		}
+		if document.Data.ID != article.ID || document.Data.Title != "Negotiated" {
+			t.Fatalf("unexpected XML article %+v", document.Data)
+		}
+
+		// a cached JSON representation does not validate the XML one
+		recorder = server.do(http.MethodGet, path, token, nil, "Accept", "application/xml", "If-None-Match", `"1"`)
+		expectStatus(t, recorder, http.StatusOK)
+		recorder = server.do(http.MethodGet, path, token, nil, "Accept", "application/xml", "If-None-Match", `"1-xml"`)
+		expectStatus(t, recorder, http.StatusNotModified)
+
+		recorder = server.do(http.MethodGet, path, token, nil, "Accept", "image/png")
+		expectProblem(t, recorder, http.StatusNotAcceptable, CodeNotAcceptable)
+
+		// every format's tag names the same version for If-Match
+		update := map[string]string{"title": "Negotiated", "content": "updated"}
+		recorder = server.do(http.MethodPut, path, token, update, "If-Match", `"1-xml"`)
+		expectStatus(t, recorder, http.StatusOK)
+	})
+}
+
+func TestArticleListETagDependsOnFormat(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		server.createArticle(token, "Listed", "content")
+
+		jsonETag := server.do(http.MethodGet, "/v1/articles", token, nil).Header().Get("ETag")
+		xmlETag := server.do(http.MethodGet, "/v1/articles", token, nil, "Accept", "application/xml").Header().Get("ETag")
+		if jsonETag == "" || jsonETag == xmlETag {
+			t.Fatalf("expected different ETags for JSON and XML, got %s and %s", jsonETag, xmlETag)
+		}
+	})
+}
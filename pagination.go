@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultArticlePageSize = 20
+	maxArticlePageSize     = 100
+)
+
+// encodeCursor turns a cursor into the opaque string handed out to clients as next_cursor
+func encodeCursor(cursor *ArticleCursor) string {
+	encoded, err := json.Marshal(cursor)
+	if err != nil {
+		// a cursor only holds a timestamp and a string, which always encode
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor reads a cursor previously produced by encodeCursor
+func decodeCursor(value string) (*ArticleCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("cursor is malformed")
+	}
+	var cursor ArticleCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.ID == "" {
+		return nil, errors.New("cursor is malformed")
+	}
+	return &cursor, nil
+}
+
+// parseQueryTimestamp reads a timestamp query parameter formatted as RFC 3339 or as a plain date
+func parseQueryTimestamp(name, value string) (*time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if timestamp, err := time.Parse(layout, value); err == nil {
+			timestamp = timestamp.UTC()
+			return &timestamp, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or a date like 2006-01-02", name)
+}
+
+// parseArticleQuery reads the limit, cursor, sort, order, status, created_after and created_before query parameters of a request listing articles
+func parseArticleQuery(request *http.Request) (ArticleQuery, error) {
+	query := ArticleQuery{Limit: defaultArticlePageSize, Sort: SortByCreatedAt, Status: StatusPublished}
+	values := request.URL.Query()
+
+	if status := ArticleStatus(values.Get("status")); status != "" {
+		if !status.isValid() {
+			return query, errors.New("status must be one of draft, published or archived")
+		}
+		query.Status = status
+	}
+
+	switch sort := ArticleSort(values.Get("sort")); sort {
+	case "":
+	case SortByCreatedAt, SortByModifiedAt, SortByTitle:
+		query.Sort = sort
+	default:
+		return query, errors.New("sort must be one of created_at, modified_at or title")
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, errors.New("order must be either asc or desc")
+	}
+
+	if createdAfter := values.Get("created_after"); createdAfter != "" {
+		timestamp, err := parseQueryTimestamp("created_after", createdAfter)
+		if err != nil {
+			return query, err
+		}
+		query.CreatedAfter = timestamp
+	}
+	if createdBefore := values.Get("created_before"); createdBefore != "" {
+		timestamp, err := parseQueryTimestamp("created_before", createdBefore)
+		if err != nil {
+			return query, err
+		}
+		query.CreatedBefore = timestamp
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit < 1 || parsedLimit > maxArticlePageSize {
+			return query, errors.New("limit must be a number between 1 and " + strconv.Itoa(maxArticlePageSize))
+		}
+		query.Limit = parsedLimit
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		if after.Sort != query.Sort || after.Descending != query.Descending {
+			return query, errors.New("cursor belongs to a different sort or order")
+		}
+		query.After = after
+	}
+	return query, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestArticlePagesFollowCursor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		created := map[string]bool{}
+		for _, title := range []string{"one", "two", "three", "four", "five"} {
+			created[server.createArticle(token, title, "content").ID] = true
+		}
+
+		seen := map[string]bool{}
+		path := "/v1/articles?limit=2"
+		for pages := 1; ; pages++ {
+			if pages > 3 {
+				t.Fatal("expected three pages of articles")
+			}
+			recorder := server.do(http.MethodGet, path, token, nil)
+			expectStatus(t, recorder, http.StatusOK)
+			var articles []*Article
+			envelope := decodeData(t, recorder, &articles)
+			if envelope.Meta == nil || envelope.Meta.Count != len(articles) || len(articles) > 2 {
+				t.Fatalf("page %d has %d articles and meta %+v", pages, len(articles), envelope.Meta)
+			}
+			for _, article := range articles {
+				if seen[article.ID] {
+					t.Fatalf("article %s was listed twice", article.ID)
+				}
+				seen[article.ID] = true
+			}
+			if envelope.Meta.NextCursor == "" {
+				if pages != 3 {
+					t.Fatalf("the last page was page %d, expected page 3", pages)
+				}
+				break
+			}
+			path = "/v1/articles?limit=2&cursor=" + url.QueryEscape(envelope.Meta.NextCursor)
+		}
+		if len(seen) != len(created) {
+			t.Fatalf("listed %d articles, expected %d", len(seen), len(created))
+		}
+	})
+}
+
+func TestArticlePageRejectsMalformedCursor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+
+		recorder := server.do(http.MethodGet, "/v1/articles?cursor=not-a-cursor", token, nil)
+		expectProblem(t, recorder, http.StatusBadRequest, CodeValidationFailed)
+		recorder = server.do(http.MethodGet, "/v1/articles?limit=0", token, nil)
+		expectProblem(t, recorder, http.StatusBadRequest, CodeValidationFailed)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// Media types of the patch documents accepted by PatchArticleHandler
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedPatchType is returned for patch documents which are neither a JSON Merge Patch nor a JSON Patch
+var ErrUnsupportedPatchType = errors.New("a patch must be sent as " + mergePatchContentType + " or " + jsonPatchContentType)
+
+// MalformedPatchError is returned for a patch document which is not valid for its media type
+type MalformedPatchError struct {
+	Reason string
+}
+
+func (err *MalformedPatchError) Error() string {
+	return "malformed patch: " + err.Reason
+}
+
+// PatchConflictError is returned when a patch cannot be applied to the current version of an article,
+// like a JSON Patch whose test operation fails or which refers to a missing member
+type PatchConflictError struct {
+	Reason string
+}
+
+func (err *PatchConflictError) Error() string {
+	return "the patch cannot be applied: " + err.Reason
+}
+
+// InvalidArticleError is returned when a patch turns an article into one which cannot be stored
+type InvalidArticleError struct {
+	Field  string
+	Reason string
+}
+
+func (err *InvalidArticleError) Error() string {
+	if err.Field == "" {
+		return "the patched article " + err.Reason
+	}
+	return fmt.Sprintf("field %s of the patched article %s", err.Field, err.Reason)
+}
+
+// patchableArticleFields are the members of the JSON representation of an article which a patch may change,
+// every other member is maintained by the server
+var patchableArticleFields = map[string]bool{
+	"title":   true,
+	"content": true,
+}
+
+// ArticlePatch transforms the JSON representation of an article
+type ArticlePatch func(document []byte) ([]byte, error)
+
+// parseArticlePatch validates a patch document of given media type and returns the transformation it describes
+func parseArticlePatch(mediaType string, body []byte) (ArticlePatch, error) {
+	switch mediaType {
+	case mergePatchContentType:
+		// a merge patch which is not an object would replace the whole article
+		if !json.Valid(body) || !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+			return nil, &MalformedPatchError{Reason: "a merge patch must be a JSON object"}
+		}
+		return func(document []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(document, body)
+		}, nil
+	case jsonPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, &MalformedPatchError{Reason: "a JSON patch must be an array of operations"}
+		}
+		return patch.Apply, nil
+	default:
+		return nil, ErrUnsupportedPatchType
+	}
+}
+
+// applyPatch applies patch to the JSON representation of the article and copies the patched title and content back.
+// Patches changing any other member are rejected, while they may still test them.
+func (article *Article) applyPatch(patch ArticlePatch) error {
+	original, err := json.Marshal(article)
+	if err != nil {
+		return err
+	}
+	patched, err := patch(original)
+	if err != nil {
+		return &PatchConflictError{Reason: err.Error()}
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return &InvalidArticleError{Reason: "must be a JSON object"}
+	}
+	for _, fields := range []map[string]interface{}{before, after} {
+		for field := range fields {
+			if !patchableArticleFields[field] && !reflect.DeepEqual(before[field], after[field]) {
+				return &InvalidArticleError{Field: field, Reason: "cannot be changed"}
+			}
+		}
+	}
+
+	title, isTitleString := after["title"].(string)
+	if !isTitleString || strings.TrimSpace(title) == "" {
+		return &InvalidArticleError{Field: "title", Reason: "must be a non empty string"}
+	}
+	content, isContentString := after["content"].(string)
+	if !isContentString {
+		return &InvalidArticleError{Field: "content", Reason: "must be a string"}
+	}
+	article.Title = title
+	article.Content = content
+	return nil
+}
+
+// PatchArticleByID applies patch to an existing article by ID, if identity is its author, an editor or an admin
+// and ifMatch lists its current version. Only the fields changed by the patch are written.
+func (blogs *Blogs) PatchArticleByID(identity *Identity, ID string, patch ArticlePatch, ifMatch string) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
+			return err
+		}
+		if err := checkIfMatch(ifMatch)(article); err != nil {
+			return err
+		}
+
+		title, content := article.Title, article.Content
+		if err := article.applyPatch(patch); err != nil {
+			return err
+		}
+		if article.Title != title || article.Content != content {
+			modifiedAt := time.Now().UTC()
+			article.ModifiedAt = &modifiedAt
+		}
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPatchArticle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		article := server.createArticle(token, "Patched", "Original content")
+		path := "/v1/articles/" + article.ID
+
+		recorder := server.do(http.MethodPatch, path, token, `{"title": "Merged"}`, "Content-Type", mergePatchContentType)
+		expectStatus(t, recorder, http.StatusOK)
+		patched := &Article{}
+		decodeData(t, recorder, patched)
+		if patched.Title != "Merged" || patched.Content != "Original content" {
+			t.Fatalf("merge patch produced %+v", patched)
+		}
+
+		operations := `[{"op": "test", "path": "/title", "value": "Merged"}, {"op": "replace", "path": "/content", "value": "Replaced"}]`
+		recorder = server.do(http.MethodPatch, path, token, operations, "Content-Type", jsonPatchContentType)
+		expectStatus(t, recorder, http.StatusOK)
+		decodeData(t, recorder, patched)
+		if patched.Title != "Merged" || patched.Content != "Replaced" {
+			t.Fatalf("JSON patch produced %+v", patched)
+		}
+
+		// the test operation no longer holds, so nothing is applied
+		operations = `[{"op": "test", "path": "/title", "value": "Patched"}, {"op": "replace", "path": "/content", "value": "Lost"}]`
+		recorder = server.do(http.MethodPatch, path, token, operations, "Content-Type", jsonPatchContentType)
+		expectProblem(t, recorder, http.StatusConflict, CodePatchConflict)
+
+		recorder = server.do(http.MethodPatch, path, token, `{"title": "Plain"}`)
+		expectProblem(t, recorder, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType)
+		recorder = server.do(http.MethodPatch, path, token, `{"title": `, "Content-Type", mergePatchContentType)
+		expectProblem(t, recorder, http.StatusBadRequest, CodeMalformedRequest)
+
+		recorder = server.do(http.MethodGet, path, token, nil)
+		decodeData(t, recorder, patched)
+		if patched.Title != "Merged" || patched.Content != "Replaced" || patched.Version != 3 {
+			t.Fatalf("the stored article is %+v", patched)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// problemContentType is the media type of RFC 7807 problem details, which every error response is written as
+const problemContentType = "application/problem+json"
+
+// problemTypeBaseURI prefixes the code of an error to form the type URI of its problem details
+const problemTypeBaseURI = "/v1/problems/"
+
+// ErrorCode identifies the kind of an error response. Codes are stable, so clients may rely on them instead of messages.
+type ErrorCode string
+
+// Error codes, grouped by HTTP status
+const (
+	CodeMalformedRequest       ErrorCode = "malformed_request"
+	CodeValidationFailed       ErrorCode = "validation_failed"
+	CodeUnsupportedQuery       ErrorCode = "unsupported_query"
+	CodeAuthTokenMissing       ErrorCode = "auth_token_missing"
+	CodeAuthTokenInvalid       ErrorCode = "auth_token_invalid"
+	CodeAuthTokenExpired       ErrorCode = "auth_token_expired"
+	CodeAuthTokenRevoked       ErrorCode = "auth_token_revoked"
+	CodeLoginFailed            ErrorCode = "login_failed"
+	CodeRefreshTokenInvalid    ErrorCode = "refresh_token_invalid"
+	CodeRefreshTokenReused     ErrorCode = "refresh_token_reused"
+	CodeInsufficientRole       ErrorCode = "insufficient_role"
+	CodeNotArticleAuthor       ErrorCode = "not_article_author"
+	CodeNotFound               ErrorCode = "not_found"
+	CodeArticleNotFound        ErrorCode = "article_not_found"
+	CodeRevisionNotFound       ErrorCode = "revision_not_found"
+	CodeUserNotFound           ErrorCode = "user_not_found"
+	CodeMethodNotAllowed       ErrorCode = "method_not_allowed"
+	CodeNotAcceptable          ErrorCode = "not_acceptable"
+	CodeUserAlreadyExists      ErrorCode = "user_already_exists"
+	CodeArticleStateConflict   ErrorCode = "article_state_conflict"
+	CodePatchConflict          ErrorCode = "patch_conflict"
+	CodeArticleVersionMismatch ErrorCode = "article_version_mismatch"
+	CodeRequestBodyTooLarge    ErrorCode = "request_body_too_large"
+	CodeUnsupportedMediaType   ErrorCode = "unsupported_media_type"
+	CodeArticleInvalid         ErrorCode = "article_invalid"
+	CodeDiffTooLarge           ErrorCode = "diff_too_large"
+	CodeInternalError          ErrorCode = "internal_error"
+	CodeStorageUnavailable     ErrorCode = "storage_unavailable"
+)
+
+// ProblemType describes every error response carrying the same code
+type ProblemType struct {
+	Code   ErrorCode `json:"code"`
+	Status int       `json:"status"`
+	Title  string    `json:"title"`
+}
+
+// problemTypes is the catalog of every error code the API responds with
+var problemTypes = map[ErrorCode]ProblemType{}
+
+func init() {
+	for _, problemType := range []ProblemType{
+		{CodeMalformedRequest, http.StatusBadRequest, "The request is malformed"},
+		{CodeValidationFailed, http.StatusBadRequest, "The request failed validation"},
+		{CodeUnsupportedQuery, http.StatusBadRequest, "This combination of sort and filters is not supported"},
+		{CodeAuthTokenMissing, http.StatusUnauthorized, "A bearer token is required"},
+		{CodeAuthTokenInvalid, http.StatusUnauthorized, "The bearer token is invalid"},
+		{CodeAuthTokenExpired, http.StatusUnauthorized, "The bearer token has expired"},
+		{CodeAuthTokenRevoked, http.StatusUnauthorized, "The bearer token was revoked"},
+		{CodeLoginFailed, http.StatusUnauthorized, "The email or password is wrong"},
+		{CodeRefreshTokenInvalid, http.StatusUnauthorized, "The refresh token is unknown, expired or revoked"},
+		{CodeRefreshTokenReused, http.StatusUnauthorized, "The refresh token was already used, its whole family is revoked"},
+		{CodeInsufficientRole, http.StatusForbidden, "The user's role does not allow this"},
+		{CodeNotArticleAuthor, http.StatusForbidden, "Only the author of the article, an editor or an admin can do this"},
+		{CodeNotFound, http.StatusNotFound, "The resource does not exist"},
+		{CodeArticleNotFound, http.StatusNotFound, "The article does not exist"},
+		{CodeRevisionNotFound, http.StatusNotFound, "The revision does not exist"},
+		{CodeUserNotFound, http.StatusNotFound, "The user does not exist"},
+		{CodeMethodNotAllowed, http.StatusMethodNotAllowed, "The method is not allowed for this resource"},
+		{CodeNotAcceptable, http.StatusNotAcceptable, "The resource cannot be sent in any of the accepted media types"},
+		{CodeUserAlreadyExists, http.StatusConflict, "A user with this email already exists"},
+		{CodeArticleStateConflict, http.StatusConflict, "The article is not in a state allowing this"},
+		{CodePatchConflict, http.StatusConflict, "The patch does not apply to the article"},
+		{CodeArticleVersionMismatch, http.StatusPreconditionFailed, "The article was modified since it was read"},
+		{CodeRequestBodyTooLarge, http.StatusRequestEntityTooLarge, "The request body is too large"},
+		{CodeUnsupportedMediaType, http.StatusUnsupportedMediaType, "The request body has an unsupported media type"},
+		{CodeArticleInvalid, http.StatusUnprocessableEntity, "The article would become invalid"},
+		{CodeDiffTooLarge, http.StatusUnprocessableEntity, "The revisions differ too much to be compared"},
+		{CodeInternalError, http.StatusInternalServerError, "An internal error occurred"},
+		{CodeStorageUnavailable, http.StatusServiceUnavailable, "The storage is unavailable"},
+	} {
+		problemTypes[problemType.Code] = problemType
+	}
+}
+
+// FieldError describes why a single field of the request was rejected
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error is an RFC 7807 problem details object. Only Code is required, the rest is filled in from its ProblemType.
+type Error struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   ErrorCode    `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ExitWithError exits from a function when any type of err was caught during http communication,
+// responding with the problem details of statusMessage
+func ExitWithError(response http.ResponseWriter, statusMessage Error) {
+	problemType, ok := problemTypes[statusMessage.Code]
+	if !ok {
+		log.Printf("error code %q is missing from the catalog\n", statusMessage.Code)
+		problemType = problemTypes[CodeInternalError]
+	}
+	statusMessage.Type = problemTypeBaseURI + string(statusMessage.Code)
+	statusMessage.Title = problemType.Title
+	statusMessage.Status = problemType.Status
+
+	response.Header().Set("Content-Type", problemContentType)
+	response.WriteHeader(problemType.Status)
+	json.NewEncoder(response).Encode(statusMessage)
+}
+
+// exitWithStoreError responds with the problem details matching an error returned by the article or user store.
+// Errors without a matching code are logged instead of being shown, since they may reveal the internals of the store.
+func exitWithStoreError(response http.ResponseWriter, err error) {
+	statusMessage := Error{Code: CodeStorageUnavailable}
+	switch err {
+	case ErrArticleNotFound:
+		statusMessage.Code = CodeArticleNotFound
+	case ErrRevisionNotFound:
+		statusMessage.Code = CodeRevisionNotFound
+	case ErrUserNotFound:
+		statusMessage.Code = CodeUserNotFound
+	case ErrUserAlreadyExists:
+		statusMessage.Code = CodeUserAlreadyExists
+	case ErrRefreshTokenNotFound:
+		statusMessage.Code = CodeRefreshTokenInvalid
+	case ErrNotArticleAuthor:
+		statusMessage.Code = CodeNotArticleAuthor
+	case ErrPreconditionFailed:
+		statusMessage.Code = CodeArticleVersionMismatch
+		statusMessage.Detail = "Fetch the article again before changing it."
+	case ErrUnsupportedQuery:
+		statusMessage.Code = CodeUnsupportedQuery
+	case ErrArticleStatusUnchanged, ErrArticleNotDraft, ErrArticleNotScheduled, ErrArticleNotTrashed:
+		statusMessage.Code = CodeArticleStateConflict
+		statusMessage.Detail = err.Error()
+	case ErrPublishAtInPast:
+		statusMessage.Code = CodeValidationFailed
+		statusMessage.Errors = []FieldError{{Field: "publish_at", Reason: "must be in the future"}}
+	default:
+		if _, ok := err.(*DocumentError); ok {
+			statusMessage.Code = CodeInternalError
+		} else if status.Code(err) == codes.NotFound {
+			statusMessage.Code = CodeNotFound
+		}
+		log.Println(err)
+	}
+	ExitWithError(response, statusMessage)
+}
+
+// ProblemTypeHandler describes the error code a problem type URI ends with
+func ProblemTypeHandler(response http.ResponseWriter, request *http.Request) {
+	problemType, ok := problemTypes[ErrorCode(mux.Vars(request)["code"])]
+	if !ok {
+		statusMessage := Error{
+			Code: CodeNotFound,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: problemType}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// notFoundHandler answers requests whose path matches no route
+func notFoundHandler(response http.ResponseWriter, request *http.Request) {
+	statusMessage := Error{
+		Code: CodeNotFound,
+	}
+	ExitWithError(response, statusMessage)
+}
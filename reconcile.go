@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/auth"
+)
+
+// signupGracePeriod is how old an auth user without a user document must be before it counts as orphaned,
+// since Signup creates the auth user before storing the user
+const signupGracePeriod = 10 * time.Minute
+
+// signupClaim is the custom claim Signup marks its auth users with, telling them apart from users of Firebase clients,
+// which have no user document until their first request
+const signupClaim = "api_signup"
+
+// claimingUserStore is a UserStore which claims the email of every user it stores, like FirestoreUserStore
+type claimingUserStore interface {
+	UserStore
+	// emailClaims returns the generated ID of the user claiming each email, keyed by lower case email
+	emailClaims(ctx context.Context) (map[string]string, error)
+	// allUsers returns every stored user, and the stored users which cannot be decoded apart
+	allUsers(ctx context.Context) ([]*User, []*DocumentError, error)
+	// claimEmail claims the email of a user, or returns ErrUserAlreadyExists when it is already claimed
+	claimEmail(ctx context.Context, user *User) error
+	// emailClaimOwner returns the generated ID of the user claiming email, or ErrUserNotFound when it is not claimed
+	emailClaimOwner(ctx context.Context, email string) (string, error)
+	// deleteEmailClaim deletes the claim of email
+	deleteEmailClaim(ctx context.Context, email string) error
+}
+
+// errNotRepaired is returned by a fix which finds that the drift must be repaired by hand after all
+var errNotRepaired = errors.New("the drift must be repaired by hand")
+
+// reconciliation counts the drift found between Firebase Auth and the "users" collection, and how much was repaired
+type reconciliation struct {
+	repair   bool
+	found    int
+	repaired int
+}
+
+// report logs a drift, and runs fix to repair it unless only checking
+func (result *reconciliation) report(fix func() error, format string, args ...interface{}) error {
+	result.found++
+	log.Printf(format+"\n", args...)
+	if !result.repair || fix == nil {
+		return nil
+	}
+	err := fix()
+	if err == errNotRepaired {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result.repaired++
+	return nil
+}
+
+// runReconcileCommand implements the "reconcile" subcommand: "reconcile" and "reconcile check" list the drift between
+// Firebase Auth and the users stored inside Firestore, "reconcile repair" repairs it
+func runReconcileCommand(storage *Storage, args []string) error {
+	store, ok := storage.Users.(claimingUserStore)
+	if !ok || storage.AuthClient == nil {
+		log.Printf("The %q storage backend keeps users in a single place, there is nothing to reconcile\n", env.StorageBackend)
+		return nil
+	}
+
+	result := &reconciliation{}
+	if len(args) > 0 {
+		switch args[0] {
+		case "check":
+		case "repair":
+			result.repair = true
+		default:
+			return fmt.Errorf("unknown reconcile command %q, expected \"check\" or \"repair\"", args[0])
+		}
+	}
+
+	if err := reconcileUsers(context.Background(), store, storage.AuthClient, result); err != nil {
+		return err
+	}
+	if result.repair {
+		log.Printf("Found %d drift(s), repaired %d\n", result.found, result.repaired)
+	} else {
+		log.Printf("Found %d drift(s), run the \"reconcile repair\" subcommand to repair them\n", result.found)
+	}
+	return nil
+}
+
+// reconcileUsers compares every auth user with the user documents and their email claims
+func reconcileUsers(ctx context.Context, store claimingUserStore, authClient AuthClient, result *reconciliation) error {
+	// claims are read first, since a signup stores its user along with the claim, so every claim read has its user read too
+	claims, err := store.emailClaims(ctx)
+	if err != nil {
+		return err
+	}
+	users, invalid, err := store.allUsers(ctx)
+	if err != nil {
+		return err
+	}
+	// the auth user and the claim of a user whose document cannot be decoded would look orphaned, and be deleted
+	for _, documentErr := range invalid {
+		result.report(nil, "Found an %v, it must be fixed by hand", documentErr)
+	}
+	if result.repair && len(invalid) > 0 {
+		return fmt.Errorf("%d user document(s) cannot be decoded, fix them before repairing", len(invalid))
+	}
+	usersByID := map[string]*User{}
+	usersByEmail := map[string][]*User{}
+	var emails []string
+	for _, user := range users {
+		usersByID[user.GeneratedID] = user
+		email := strings.ToLower(user.Email)
+		if len(usersByEmail[email]) == 0 {
+			emails = append(emails, email)
+		}
+		usersByEmail[email] = append(usersByEmail[email], user)
+	}
+
+	records, err := authClient.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	authUsers := map[string]*auth.ExportedUserRecord{}
+	authUsersByEmail := map[string]*auth.ExportedUserRecord{}
+	var authUserIDs []string
+	for _, record := range records {
+		authUsers[record.UID] = record
+		authUsersByEmail[strings.ToLower(record.Email)] = record
+		authUserIDs = append(authUserIDs, record.UID)
+	}
+	// sorted so that reports are stable
+	sort.Strings(authUserIDs)
+
+	// auth users left behind by a signup which failed to store the user, which keep their email from signing up again
+	for _, UID := range authUserIDs {
+		record := authUsers[UID]
+		if _, ok := usersByID[UID]; ok {
+			continue
+		}
+		if signedUp, _ := record.CustomClaims[signupClaim].(bool); !signedUp {
+			result.report(nil, "Auth user %s (%s) has no user document and was not created by a signup, "+
+				"it is stored on its first request unless it is deleted by hand", UID, record.Email)
+			continue
+		}
+		if record.UserMetadata != nil {
+			createdAt := time.Unix(0, record.UserMetadata.CreationTimestamp*int64(time.Millisecond))
+			if time.Since(createdAt) < signupGracePeriod {
+				log.Printf("Skipping auth user %s created at %s, its signup may still be running\n", UID, createdAt.Format(time.RFC3339))
+				continue
+			}
+		}
+		err := result.report(func() error {
+			return authClient.DeleteUser(ctx, UID)
+		}, "Auth user %s (%s) has no user document, deleting it", UID, record.Email)
+		if err != nil {
+			return err
+		}
+		// its email is free for the user stored with it, if any
+		delete(authUsersByEmail, strings.ToLower(record.Email))
+	}
+
+	// users without an auth user can still log in with their stored password, but not through Firebase.
+	// Users sharing their email with another user are merged by hand below.
+	for _, user := range users {
+		email := strings.ToLower(user.Email)
+		if _, ok := authUsers[user.GeneratedID]; ok || len(usersByEmail[email]) > 1 {
+			continue
+		}
+		if record, ok := authUsersByEmail[email]; ok {
+			result.report(nil, "User %s (%s) has no auth user, while the auth user %s has its email, they must be merged by hand",
+				user.GeneratedID, user.Email, record.UID)
+			continue
+		}
+		err := result.report(func() error {
+			params := (&auth.UserToCreate{}).UID(user.GeneratedID).Email(user.Email)
+			_, err := authClient.CreateUser(ctx, params)
+			// a signup may have created an auth user with this email since the auth users were read
+			if auth.IsEmailAlreadyExists(err) {
+				log.Printf("Another auth user took the email %s meanwhile, merge it with user %s by hand\n", user.Email, user.GeneratedID)
+				return errNotRepaired
+			}
+			return err
+		}, "User %s (%s) has no auth user, creating one without a password", user.GeneratedID, user.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	// users registered twice before emails were claimed own articles, so they are merged by hand
+	for _, email := range emails {
+		if duplicates := usersByEmail[email]; len(duplicates) > 1 {
+			IDs := make([]string, len(duplicates))
+			for i, user := range duplicates {
+				IDs[i] = user.GeneratedID
+			}
+			result.report(nil, "Email %s is used by the users %s, which must be merged by hand", email, strings.Join(IDs, ", "))
+		}
+	}
+
+	claimedEmails := make([]string, 0, len(claims))
+	for email := range claims {
+		claimedEmails = append(claimedEmails, email)
+	}
+	sort.Strings(claimedEmails)
+	for _, email := range claimedEmails {
+		ID := claims[email]
+		if user, ok := usersByID[ID]; ok && strings.ToLower(user.Email) == email {
+			continue
+		}
+		err := result.report(func() error {
+			return store.deleteEmailClaim(ctx, email)
+		}, "Email %s is claimed by %q, which is not a user with this email, deleting the claim", email, ID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, user := range users {
+		email := strings.ToLower(user.Email)
+		if claims[email] == user.GeneratedID || len(usersByEmail[email]) > 1 {
+			continue
+		}
+		err := result.report(func() error {
+			err := store.claimEmail(ctx, user)
+			// a signup may have claimed it since the claims were read
+			if err == ErrUserAlreadyExists {
+				owner, err := store.emailClaimOwner(ctx, user.Email)
+				if err != nil {
+					return err
+				}
+				log.Printf("User %s claimed the email %s meanwhile, merge it with user %s by hand\n", owner, user.Email, user.GeneratedID)
+				return errNotRepaired
+			}
+			return err
+		}, "Email %s of user %s is not claimed, claiming it", user.Email, user.GeneratedID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
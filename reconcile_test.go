@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClaimingStore is a claimingUserStore holding the users and claims given to it
+type fakeClaimingStore struct {
+	UserStore
+	users  []*User
+	claims map[string]string
+	// beforeClaim runs before an email is claimed, like a concurrent signup would
+	beforeClaim func()
+}
+
+// newFakeClaimingStore returns a store holding users, whose emails are claimed
+func newFakeClaimingStore(users ...*User) *fakeClaimingStore {
+	store := &fakeClaimingStore{UserStore: initMemoryUserStore(), users: users, claims: map[string]string{}}
+	for _, user := range users {
+		store.claims[strings.ToLower(user.Email)] = user.GeneratedID
+	}
+	return store
+}
+
+func (store *fakeClaimingStore) emailClaims(ctx context.Context) (map[string]string, error) {
+	claims := map[string]string{}
+	for email, ID := range store.claims {
+		claims[email] = ID
+	}
+	return claims, nil
+}
+
+func (store *fakeClaimingStore) allUsers(ctx context.Context) ([]*User, []*DocumentError, error) {
+	return store.users, nil, nil
+}
+
+func (store *fakeClaimingStore) claimEmail(ctx context.Context, user *User) error {
+	if store.beforeClaim != nil {
+		store.beforeClaim()
+	}
+	email := strings.ToLower(user.Email)
+	if _, ok := store.claims[email]; ok {
+		return ErrUserAlreadyExists
+	}
+	store.claims[email] = user.GeneratedID
+	return nil
+}
+
+func (store *fakeClaimingStore) emailClaimOwner(ctx context.Context, email string) (string, error) {
+	ID, ok := store.claims[strings.ToLower(email)]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return ID, nil
+}
+
+func (store *fakeClaimingStore) deleteEmailClaim(ctx context.Context, email string) error {
+	delete(store.claims, strings.ToLower(email))
+	return nil
+}
+
+func TestReconcileOnlyDeletesAuthUsersOfFailedSignups(t *testing.T) {
+	ctx := context.Background()
+	longAgo := time.Now().Add(-time.Hour)
+	authClient := newFakeAuthClient()
+	authClient.addUser("stored", "stored@example.com", longAgo)
+	authClient.addUser("failed-signup", "failed@example.com", longAgo).CustomClaims = map[string]interface{}{signupClaim: true}
+	authClient.addUser("running-signup", "running@example.com", time.Now()).CustomClaims = map[string]interface{}{signupClaim: true}
+	authClient.addUser("web-client", "web@example.com", longAgo)
+	store := newFakeClaimingStore(&User{GeneratedID: "stored", Email: "stored@example.com", Role: defaultRole})
+
+	check := &reconciliation{}
+	if err := reconcileUsers(ctx, store, authClient, check); err != nil {
+		t.Fatal(err)
+	}
+	if check.found != 2 || check.repaired != 0 || len(authClient.users) != 4 {
+		t.Fatalf("expected checking to find 2 drifts and change nothing, found %d and kept %d auth users", check.found, len(authClient.users))
+	}
+
+	repair := &reconciliation{repair: true}
+	if err := reconcileUsers(ctx, store, authClient, repair); err != nil {
+		t.Fatal(err)
+	}
+	if repair.found != 2 || repair.repaired != 1 {
+		t.Fatalf("expected 2 drifts with 1 repaired, got %+v", repair)
+	}
+	if _, ok := authClient.users["failed-signup"]; ok {
+		t.Fatal("expected the auth user of the failed signup to be deleted")
+	}
+	// a user of a Firebase client is stored on their first request, and a signup may still store its user
+	for _, UID := range []string{"stored", "running-signup", "web-client"} {
+		if _, ok := authClient.users[UID]; !ok {
+			t.Fatalf("expected auth user %s to be kept", UID)
+		}
+	}
+}
+
+func TestReconcileClaimsUnclaimedEmails(t *testing.T) {
+	ctx := context.Background()
+	authClient := newFakeAuthClient()
+	store := newFakeClaimingStore()
+	for _, user := range []*User{
+		{GeneratedID: "unclaimed", Email: "Unclaimed@example.com", Role: defaultRole},
+		{GeneratedID: "raced", Email: "raced@example.com", Role: defaultRole},
+	} {
+		authClient.addUser(user.GeneratedID, user.Email, time.Now())
+		store.users = append(store.users, user)
+	}
+	store.beforeClaim = func() {
+		// a signup claims the email between reading the claims and claiming it
+		store.claims["raced@example.com"] = "signup"
+	}
+
+	result := &reconciliation{repair: true}
+	if err := reconcileUsers(ctx, store, authClient, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.found != 2 || result.repaired != 1 {
+		t.Fatalf("expected 2 drifts with only the unclaimed email repaired, got %+v", result)
+	}
+	if store.claims["unclaimed@example.com"] != "unclaimed" || store.claims["raced@example.com"] != "signup" {
+		t.Fatalf("unexpected claims %v", store.claims)
+	}
+}
+
+func TestSignupMarksAuthUsers(t *testing.T) {
+	server := newTestServer(t, nil)
+	authClient := newFakeAuthClient()
+	server.users.authClient = authClient
+
+	server.login("author@example.com")
+	user, err := server.users.store.GetUserByEmail(context.Background(), "author@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, ok := authClient.users[user.GeneratedID]
+	if !ok || record.CustomClaims[signupClaim] != true {
+		t.Fatalf("expected the auth user of the signup to be marked, got %+v", record)
+	}
+	expectStatus(t, server.do(http.MethodGet, "/v1/articles", server.login("author@example.com").AccessToken, nil), http.StatusOK)
+}
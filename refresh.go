@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// accessTokenTTL is how long an access token minted by Users.createTokenForAuth is accepted
+const accessTokenTTL = time.Hour
+
+// defaultRefreshTokenTTL is how long a refresh token can be exchanged, unless REFRESH_TOKEN_TTL is set
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshToken is a long-lived token which can be exchanged once for a new access token and refresh token.
+// Tokens issued by exchanging another one belong to the same family, which is started by a login.
+type RefreshToken struct {
+	// ID is the hash of the token handed to the client, which is never stored
+	ID        string
+	FamilyID  string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// isActive reports whether the token can still be exchanged at now
+func (token *RefreshToken) isActive(now time.Time) bool {
+	return token.RevokedAt == nil && now.Before(token.ExpiresAt)
+}
+
+// TokenPair holds the tokens returned by Login and RefreshTokenHandler
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newTokenPair pairs an access token minted now with a refresh token
+func newTokenPair(accessToken, refreshToken string) *TokenPair {
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL / time.Second),
+		RefreshToken: refreshToken,
+	}
+}
+
+// hashRefreshToken returns the ID a refresh token is stored under, so that reading the store does not reveal usable tokens
+func hashRefreshToken(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// issueRefreshToken stores a new refresh token of the user belonging to familyID and returns the value handed to the client
+func (users *Users) issueRefreshToken(ctx context.Context, userID, familyID string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(random)
+
+	now := time.Now().UTC()
+	token := &RefreshToken{
+		ID:        hashRefreshToken(value),
+		FamilyID:  familyID,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(users.refreshTokenTTL),
+	}
+	if err := users.tokens.AddRefreshToken(ctx, token); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and refresh token.
+// Exchanging a refresh token a second time revokes the session of its family, including the access tokens issued within it.
+func (users *Users) RefreshTokenHandler(response http.ResponseWriter, request *http.Request) {
+	input, err := decodeInput(request, "refresh_token")
+	if err != nil {
+		exitWithInputError(response, err)
+		return
+	}
+	value := input.Get("refresh_token")
+	if value == "" {
+		statusMessage := Error{
+			Code:   CodeValidationFailed,
+			Detail: "Refresh token is required.",
+			Errors: []FieldError{{Field: "refresh_token", Reason: "is required"}},
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	token, err := users.tokens.UseRefreshToken(ctx, hashRefreshToken(value), now)
+	if err == ErrRefreshTokenReused {
+		// either the token was stolen or its owner replays it, so no token of the session can be trusted anymore
+		if err := users.revokeSession(ctx, token.FamilyID, now); err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+		log.Printf("Revoked session %s of user %s after one of its refresh tokens was reused\n", token.FamilyID, token.UserID)
+		statusMessage := Error{
+			Code:   CodeRefreshTokenReused,
+			Detail: "This refresh token was already used, so every token of this login was revoked. Please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrRefreshTokenNotFound {
+		statusMessage := Error{
+			Code:   CodeRefreshTokenInvalid,
+			Detail: "The refresh token is unknown, please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err == ErrRefreshTokenInactive {
+		statusMessage := Error{
+			Code:   CodeRefreshTokenInvalid,
+			Detail: "The refresh token has expired or was revoked, please log in again.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	user, err := users.store.GetUserByID(ctx, token.UserID)
+	if err == ErrUserNotFound {
+		statusMessage := Error{
+			Code:   CodeRefreshTokenInvalid,
+			Detail: "The user of the refresh token no longer exists.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	accessToken, err := users.createTokenForAuth(user, token.FamilyID)
+	if err != nil {
+		statusMessage := Error{
+			Code:   CodeInternalError,
+			Detail: "Failed to mint a token",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	refreshToken, err := users.issueRefreshToken(ctx, user.GeneratedID, token.FamilyID)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: newTokenPair(accessToken, refreshToken)}
+	writeResponse(response, request, statusCode, statusMessage)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// refresh exchanges refreshToken for a new token pair, which is nil unless the exchange succeeded
+func (server *testServer) refresh(refreshToken string) (*TokenPair, *httptest.ResponseRecorder) {
+	server.t.Helper()
+	recorder := server.do(http.MethodPost, "/v1/token/refresh", "", map[string]string{"refresh_token": refreshToken})
+	if recorder.Code != http.StatusOK {
+		return nil, recorder
+	}
+	tokens := &TokenPair{}
+	decodeData(server.t, recorder, tokens)
+	return tokens, recorder
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		login := server.login("author@example.com")
+
+		rotated, recorder := server.refresh(login.RefreshToken)
+		expectStatus(t, recorder, http.StatusOK)
+		if rotated.RefreshToken == login.RefreshToken || rotated.AccessToken == "" || rotated.TokenType != "Bearer" {
+			t.Fatalf("expected a new token pair, got %+v", rotated)
+		}
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", rotated.AccessToken, nil), http.StatusOK)
+
+		again, recorder := server.refresh(rotated.RefreshToken)
+		expectStatus(t, recorder, http.StatusOK)
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", again.AccessToken, nil), http.StatusOK)
+
+		_, recorder = server.refresh("unknown")
+		expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenInvalid)
+	})
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		login := server.login("author@example.com")
+		other := server.login("author@example.com")
+
+		rotated, recorder := server.refresh(login.RefreshToken)
+		expectStatus(t, recorder, http.StatusOK)
+
+		// replaying the exchanged token ends the whole session
+		_, recorder = server.refresh(login.RefreshToken)
+		expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenReused)
+		_, recorder = server.refresh(rotated.RefreshToken)
+		expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenInvalid)
+		for _, accessToken := range []string{login.AccessToken, rotated.AccessToken} {
+			recorder = server.do(http.MethodGet, "/v1/articles", accessToken, nil)
+			expectProblem(t, recorder, http.StatusUnauthorized, CodeAuthTokenRevoked)
+		}
+
+		// other logins of the same user go on
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", other.AccessToken, nil), http.StatusOK)
+		_, recorder = server.refresh(other.RefreshToken)
+		expectStatus(t, recorder, http.StatusOK)
+	})
+}
+
+func TestInactiveRefreshTokenIsNotUsedUp(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		loggedOut := server.login("author@example.com")
+		expectStatus(t, server.do(http.MethodPost, "/v1/logout", loggedOut.AccessToken, nil), http.StatusOK)
+		server.users.refreshTokenTTL = -time.Minute
+		expired := server.login("author@example.com")
+
+		// a rejected token keeps being rejected as invalid, rather than as reused
+		for _, refreshToken := range []string{loggedOut.RefreshToken, expired.RefreshToken} {
+			for attempt := 0; attempt < 2; attempt++ {
+				_, recorder := server.refresh(refreshToken)
+				expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenInvalid)
+			}
+		}
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", expired.AccessToken, nil), http.StatusOK)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// jsonContentType is the media type of every successful response
+const jsonContentType = "application/json"
+
+// Envelope is the body of every successful response
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Meta  *Meta       `json:"meta,omitempty"`
+	Links *Links      `json:"links,omitempty"`
+}
+
+// Meta describes the page of a list response
+type Meta struct {
+	Count int `json:"count" xml:"count"`
+	// NextCursor is passed as the cursor query parameter to request the next page, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+	// InvalidDocuments are stored articles which could not be decoded, so they were left out of the page
+	InvalidDocuments []*DocumentError `json:"invalid_documents,omitempty" xml:"invalid_document,omitempty"`
+}
+
+// Links holds the URLs related to a list response
+type Links struct {
+	Self string `json:"self" xml:"self"`
+	Next string `json:"next,omitempty" xml:"next,omitempty"`
+}
+
+// articleListEnvelope returns the envelope of a page of articles, linking to the next page if there is one
+func articleListEnvelope(request *http.Request, list *ArticleList) Envelope {
+	articles := list.Articles
+	if articles == nil {
+		articles = []*Article{}
+	}
+	// a broken document must not hide every other article, so it is skipped and flagged instead
+	for _, invalid := range list.Invalid {
+		log.Println(invalid)
+	}
+
+	envelope := Envelope{
+		Data:  articles,
+		Meta:  &Meta{Count: len(articles), InvalidDocuments: list.Invalid},
+		Links: &Links{Self: request.URL.RequestURI()},
+	}
+	if list.NextCursor != nil {
+		envelope.Meta.NextCursor = encodeCursor(list.NextCursor)
+		next := *request.URL
+		values := next.Query()
+		values.Set("cursor", envelope.Meta.NextCursor)
+		next.RawQuery = values.Encode()
+		envelope.Links.Next = next.RequestURI()
+	}
+	return envelope
+}
+
+// isPrettyRequested reports whether the pretty query parameter asks for an indented response body
+func isPrettyRequested(request *http.Request) bool {
+	values, ok := request.URL.Query()["pretty"]
+	if !ok {
+		return false
+	}
+	switch values[0] {
+	case "false", "0":
+		return false
+	default:
+		return true
+	}
+}
+
+// encodeJSON encodes value as a JSON document ending with a newline, indented when pretty
+func encodeJSON(value interface{}, pretty bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	// links carry query strings, whose & would be escaped otherwise
+	encoder.SetEscapeHTML(false)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeResponse writes envelope as the JSON body of a successful response
+func writeResponse(response http.ResponseWriter, request *http.Request, statusCode int, envelope Envelope) {
+	writeResponseAs(response, request, statusCode, envelope, jsonFormat)
+}
+
+// writeResponseAs writes envelope as the body of a successful response, encoded in format.
+// The body is encoded before anything is written, so that an encoding error can still be answered with a problem.
+func writeResponseAs(response http.ResponseWriter, request *http.Request, statusCode int, envelope Envelope, format ResponseFormat) {
+	body, err := format.encode(envelope, isPrettyRequested(request))
+	if err != nil {
+		log.Printf("error encoding response as %s: %v\n", format.ContentType(), err)
+		statusMessage := Error{
+			Code: CodeInternalError,
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	response.Header().Set("Content-Type", format.ContentType())
+	response.WriteHeader(statusCode)
+	response.Write(body)
+}
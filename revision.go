@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRevisionNotFound is returned by an ArticleStore when an article has no revision with the requested number
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is an immutable copy of the title and content of an article, written by the store whenever they change
+type Revision struct {
+	ArticleID string    `json:"article_id"`
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevisionDiff is a line based diff between the revisions From and To of an article
+type RevisionDiff struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// revisionOf copies the title and content of article into the revision with given number
+func revisionOf(article *Article, number int) *Revision {
+	return &Revision{
+		ArticleID: article.ID,
+		Number:    number,
+		Title:     article.Title,
+		Content:   article.Content,
+		CreatedAt: article.modifiedOrCreatedAt(),
+	}
+}
+
+// newRevisions returns the revisions a store writes when an update turns before into after, given the number of
+// the latest revision stored. Articles written before revisions existed have none, so their previous version is
+// kept as the first revision.
+func newRevisions(before, after *Article, latest int) []*Revision {
+	if before.Title == after.Title && before.Content == after.Content {
+		return nil
+	}
+	var revisions []*Revision
+	if latest == 0 {
+		latest++
+		revisions = append(revisions, revisionOf(before, latest))
+	}
+	return append(revisions, revisionOf(after, latest+1))
+}
+
+// ListRevisionsByID lists every revision of an existing article by ID, oldest first, if identity may modify it
+func (blogs *Blogs) ListRevisionsByID(identity *Identity, ID string) ([]*Revision, error) {
+	if err := blogs.checkCanModifyByID(identity, ID); err != nil {
+		return nil, err
+	}
+	return blogs.store.ListRevisions(context.Background(), ID)
+}
+
+// GetRevisionByID gets a single revision of an existing article by ID, if identity may modify it
+func (blogs *Blogs) GetRevisionByID(identity *Identity, ID string, number int) (*Revision, error) {
+	if err := blogs.checkCanModifyByID(identity, ID); err != nil {
+		return nil, err
+	}
+	return blogs.store.GetRevision(context.Background(), ID, number)
+}
+
+// DiffRevisionsByID returns a line based diff turning revision from into revision to of an existing article by ID
+func (blogs *Blogs) DiffRevisionsByID(identity *Identity, ID string, from, to int) (string, error) {
+	fromRevision, err := blogs.GetRevisionByID(identity, ID, from)
+	if err != nil {
+		return "", err
+	}
+	toRevision, err := blogs.store.GetRevision(context.Background(), ID, to)
+	if err != nil {
+		return "", err
+	}
+	return diffRevisions(fromRevision, toRevision)
+}
+
+// RestoreRevisionByID makes the title and content of an older revision the current version of an existing article by ID,
+// which the store records as a new revision
+func (blogs *Blogs) RestoreRevisionByID(identity *Identity, ID string, number int) error {
+	revision, err := blogs.GetRevisionByID(identity, ID, number)
+	if err != nil {
+		return err
+	}
+	return blogs.UpdateArticleByID(identity, ID, revision.Title, revision.Content, "")
+}
+
+// checkCanModifyByID returns ErrNotArticleAuthor unless identity may modify the existing article by ID
+func (blogs *Blogs) checkCanModifyByID(identity *Identity, ID string) error {
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		return err
+	}
+	return checkCanModify(identity)(article)
+}
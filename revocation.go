@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultRevocationGCInterval is how often expired revocations are deleted, unless REVOCATION_GC_INTERVAL is set
+const defaultRevocationGCInterval = time.Hour
+
+// sessionRevocationID identifies a session inside the revocation store, where revoking it rejects every access token
+// issued within the session
+func sessionRevocationID(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// revocationIDs returns the IDs the access token of identity is revoked by: its own ID and the ID of its session
+func (identity *Identity) revocationIDs() []string {
+	if identity.SessionID == "" {
+		return []string{identity.TokenID}
+	}
+	return []string{identity.TokenID, sessionRevocationID(identity.SessionID)}
+}
+
+// revokeSession ends the session started by a login: none of its refresh tokens can be exchanged anymore,
+// and every access token issued within it is rejected until it would have expired anyway
+func (users *Users) revokeSession(ctx context.Context, sessionID string, now time.Time) error {
+	if err := users.tokens.RevokeRefreshTokenFamily(ctx, sessionID, now); err != nil {
+		return err
+	}
+	return users.tokens.RevokeAccessToken(ctx, sessionRevocationID(sessionID), now.Add(accessTokenTTL))
+}
+
+// LogoutHandler revokes the access token of the request along with its session, which ends the access tokens
+// issued by refreshing it as well
+func (users *Users) LogoutHandler(response http.ResponseWriter, request *http.Request) {
+	identity := identityFromContext(request.Context())
+	ctx := context.Background()
+	err := users.tokens.RevokeAccessToken(ctx, identity.TokenID, identity.TokenExpiresAt)
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+	if identity.SessionID != "" {
+		err = users.revokeSession(ctx, identity.SessionID, time.Now().UTC())
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+	}
+
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: "Logged out."}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// RevokeUserSessionsHandler revokes every access token and refresh token of the user with given ID,
+// including the Firebase sessions of the user when users are stored inside Firebase
+func (users *Users) RevokeUserSessionsHandler(response http.ResponseWriter, request *http.Request) {
+	ID := mux.Vars(request)["id"]
+	ctx := context.Background()
+	_, err := users.store.GetUserByID(ctx, ID)
+	if err == ErrUserNotFound {
+		statusMessage := Error{
+			Code:   CodeUserNotFound,
+			Detail: "The user does not exist.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	// every access token issued until now is expired after accessTokenTTL, so the revocation is not needed any longer
+	now := time.Now().UTC()
+	err = users.tokens.RevokeUserTokens(ctx, ID, now, now.Add(accessTokenTTL))
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+	// Firebase ID tokens are revoked as well, and the web client can no longer refresh them
+	if users.authClient != nil {
+		err = users.authClient.RevokeRefreshTokens(ctx, ID)
+		if err != nil {
+			exitWithStoreError(response, err)
+			return
+		}
+	}
+
+	customMessage := fmt.Sprintf("Every session of user %s was revoked.", ID)
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: customMessage}
+	writeResponse(response, request, statusCode, statusMessage)
+}
+
+// runRevocationCollector deletes the revocations of tokens which expired since, every interval until ctx is done
+func (users *Users) runRevocationCollector(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := users.tokens.DeleteExpiredRevocations(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("error deleting expired revocations: %v\n", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired revocation(s)\n", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
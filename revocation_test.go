@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLogoutRevokesSession(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		login := server.login("author@example.com")
+		other := server.login("author@example.com")
+		rotated, recorder := server.refresh(login.RefreshToken)
+		expectStatus(t, recorder, http.StatusOK)
+
+		expectStatus(t, server.do(http.MethodPost, "/v1/logout", rotated.AccessToken, nil), http.StatusOK)
+		for _, accessToken := range []string{login.AccessToken, rotated.AccessToken} {
+			recorder = server.do(http.MethodGet, "/v1/articles", accessToken, nil)
+			expectProblem(t, recorder, http.StatusUnauthorized, CodeAuthTokenRevoked)
+		}
+		_, recorder = server.refresh(rotated.RefreshToken)
+		expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenInvalid)
+
+		// the jti and sid of the other login differ, so it is not revoked
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", other.AccessToken, nil), http.StatusOK)
+	})
+}
+
+func TestAdminRevokesUserSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		first := server.login("author@example.com")
+		second := server.login("author@example.com")
+		admin := server.login("admin@example.com").AccessToken
+		user, err := server.users.store.GetUserByEmail(context.Background(), "author@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := server.do(http.MethodDelete, "/v1/users/"+user.GeneratedID+"/sessions", first.AccessToken, nil)
+		expectProblem(t, recorder, http.StatusForbidden, CodeInsufficientRole)
+		recorder = server.do(http.MethodDelete, "/v1/users/unknown/sessions", admin, nil)
+		expectProblem(t, recorder, http.StatusNotFound, CodeUserNotFound)
+
+		expectStatus(t, server.do(http.MethodDelete, "/v1/users/"+user.GeneratedID+"/sessions", admin, nil), http.StatusOK)
+		for _, tokens := range []*TokenPair{first, second} {
+			recorder = server.do(http.MethodGet, "/v1/articles", tokens.AccessToken, nil)
+			expectProblem(t, recorder, http.StatusUnauthorized, CodeAuthTokenRevoked)
+			_, recorder = server.refresh(tokens.RefreshToken)
+			expectProblem(t, recorder, http.StatusUnauthorized, CodeRefreshTokenInvalid)
+		}
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", admin, nil), http.StatusOK)
+
+		// tokens are issued with a precision of one second, so a new login must wait for the revocation to pass
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", server.login("author@example.com").AccessToken, nil), http.StatusOK)
+	})
+}
+
+func TestRevocationCollectorForgetsExpiredRevocations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		tokens := server.users.tokens
+		if err := tokens.RevokeAccessToken(ctx, "expired", now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tokens.RevokeAccessToken(ctx, "active", now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		deleted, err := tokens.DeleteExpiredRevocations(ctx, now)
+		if err != nil || deleted != 1 {
+			t.Fatalf("expected one deleted revocation, got %d and %v", deleted, err)
+		}
+		revoked, err := tokens.IsAccessTokenRevoked(ctx, []string{"active"}, "", now)
+		if err != nil || !revoked {
+			t.Fatalf("expected the active revocation to be kept, got %v and %v", revoked, err)
+		}
+	})
+}
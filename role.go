@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Role grants a user permissions, each role including every permission of the roles below it
+type Role string
+
+// Roles from least to most privileged
+const (
+	// RoleReader may read articles
+	RoleReader Role = "reader"
+	// RoleAuthor may also write articles and modify their own
+	RoleAuthor Role = "author"
+	// RoleEditor may also modify articles of every author
+	RoleEditor Role = "editor"
+	// RoleAdmin may also manage users
+	RoleAdmin Role = "admin"
+)
+
+// defaultRole is given to newly registered users and to users stored before roles existed
+const defaultRole = RoleAuthor
+
+var roleRanks = map[Role]int{
+	RoleReader: 1,
+	RoleAuthor: 2,
+	RoleEditor: 3,
+	RoleAdmin:  4,
+}
+
+// isValid reports whether role is one of the known roles
+func (role Role) isValid() bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// includes reports whether role grants every permission of minimum
+func (role Role) includes(minimum Role) bool {
+	return role.isValid() && roleRanks[role] >= roleRanks[minimum]
+}
+
+// requireRole is a middleware which must be placed behind verifyToken, and only lets users with at least the minimum role through
+func (users *Users) requireRole(minimum Role, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		identity := identityFromContext(request.Context())
+		if identity == nil {
+			statusMessage := Error{
+				Code: CodeAuthTokenMissing,
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		if !identity.Role.includes(minimum) {
+			statusMessage := Error{
+				Code:   CodeInsufficientRole,
+				Detail: "This requires the " + string(minimum) + " role.",
+			}
+			ExitWithError(response, statusMessage)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+// ChangeUserRoleHandler changes the role of the user with given ID, the change applies from their next login
+func (users *Users) ChangeUserRoleHandler(response http.ResponseWriter, request *http.Request) {
+	input, err := decodeInput(request, "role")
+	if err != nil {
+		exitWithInputError(response, err)
+		return
+	}
+	role := Role(input.Get("role"))
+	if !role.isValid() {
+		statusMessage := Error{
+			Code:   CodeValidationFailed,
+			Detail: "Role must be one of reader, author, editor or admin.",
+			Errors: []FieldError{{Field: "role", Reason: "must be one of reader, author, editor or admin"}},
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+
+	ID := mux.Vars(request)["id"]
+	err = users.store.SetUserRole(context.Background(), ID, role)
+	if err == ErrUserNotFound {
+		statusMessage := Error{
+			Code:   CodeUserNotFound,
+			Detail: "The user does not exist.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	if err != nil {
+		exitWithStoreError(response, err)
+		return
+	}
+
+	customMessage := fmt.Sprintf("The role of user %s was changed to %s.", ID, role)
+	statusCode := http.StatusOK
+	statusMessage := Envelope{Data: customMessage}
+	writeResponse(response, request, statusCode, statusMessage)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// routeMethods are the methods checked when answering a request with 405 Method Not Allowed
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// initRouter returns the router serving the versioned API under /v1 and the deprecated legacy routes
+func initRouter(blogs *Blogs, users *Users) *mux.Router {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+
+	router.HandleFunc("/", HelloWorld).Methods(http.MethodGet)
+	router.HandleFunc("/.well-known/jwks.json", users.JWKSHandler).Methods(http.MethodGet)
+	registerV1Routes(router.PathPrefix("/v1").Subrouter(), blogs, users)
+	legacySuccessors := registerLegacyRoutes(router, blogs, users)
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router, legacySuccessors)
+	return router
+}
+
+// registerV1Routes registers the resource routes of version 1 of the API
+func registerV1Routes(router *mux.Router, blogs *Blogs, users *Users) {
+	router.HandleFunc("/users", users.Signup).Methods(http.MethodPost)
+	router.HandleFunc("/sessions", users.Login).Methods(http.MethodPost)
+	router.HandleFunc("/token/refresh", users.RefreshTokenHandler).Methods(http.MethodPost)
+	router.HandleFunc("/logout", users.verifyToken(users.LogoutHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/problems/{code}", ProblemTypeHandler).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}/role", users.verifyToken(users.requireRole(RoleAdmin, users.ChangeUserRoleHandler))).Methods(http.MethodPut)
+	router.HandleFunc("/users/{id}/sessions", users.verifyToken(users.requireRole(RoleAdmin, users.RevokeUserSessionsHandler))).Methods(http.MethodDelete)
+
+	router.HandleFunc("/articles", users.verifyToken(users.requireRole(RoleReader, blogs.ListAllArticlesHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/articles", users.verifyToken(users.requireRole(RoleAuthor, blogs.PublishArticleHandler(StatusDraft)))).Methods(http.MethodPost)
+	// registered before /articles/{id}, which would match them otherwise
+	router.HandleFunc("/articles/scheduled", users.verifyToken(users.requireRole(RoleAuthor, blogs.ListScheduledArticlesHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/articles/trash", users.verifyToken(users.requireRole(RoleAuthor, blogs.ListTrashHandler))).Methods(http.MethodGet)
+
+	router.HandleFunc("/articles/{id}", users.verifyToken(users.requireRole(RoleReader, blogs.ListArticleHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/articles/{id}", users.verifyToken(users.requireRole(RoleAuthor, blogs.UpdateArticleHandler))).Methods(http.MethodPut)
+	router.HandleFunc("/articles/{id}", users.verifyToken(users.requireRole(RoleAuthor, blogs.PatchArticleHandler))).Methods(http.MethodPatch)
+	router.HandleFunc("/articles/{id}", users.verifyToken(users.requireRole(RoleAuthor, blogs.DeleteArticleHandler))).Methods(http.MethodDelete)
+	router.HandleFunc("/articles/{id}/restore", users.verifyToken(users.requireRole(RoleAuthor, blogs.RestoreArticleHandler))).Methods(http.MethodPost)
+	router.HandleFunc("/articles/{id}/publish", users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusPublished)))).Methods(http.MethodPost)
+	router.HandleFunc("/articles/{id}/unpublish", users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusDraft)))).Methods(http.MethodPost)
+	router.HandleFunc("/articles/{id}/archive", users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusArchived)))).Methods(http.MethodPost)
+	router.HandleFunc("/articles/{id}/schedule", users.verifyToken(users.requireRole(RoleAuthor, blogs.ScheduleArticleHandler))).Methods(http.MethodPut)
+	router.HandleFunc("/articles/{id}/schedule", users.verifyToken(users.requireRole(RoleAuthor, blogs.CancelScheduledArticleHandler))).Methods(http.MethodDelete)
+
+	router.HandleFunc("/articles/{id}/revisions", users.verifyToken(users.requireRole(RoleAuthor, blogs.ListRevisionsHandler))).Methods(http.MethodGet)
+	// registered before /articles/{id}/revisions/{revision}, which would match it otherwise
+	router.HandleFunc("/articles/{id}/revisions/diff", users.verifyToken(users.requireRole(RoleAuthor, blogs.DiffRevisionsHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/articles/{id}/revisions/{revision}", users.verifyToken(users.requireRole(RoleAuthor, blogs.GetRevisionHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/articles/{id}/revisions/{revision}/restore", users.verifyToken(users.requireRole(RoleAuthor, blogs.RestoreRevisionHandler))).Methods(http.MethodPost)
+}
+
+// registerLegacyRoutes registers the unversioned routes the API started with, which are deprecated in favor of /v1.
+// It returns the successor of every legacy path template, so that other responses to them can be marked as deprecated too.
+func registerLegacyRoutes(router *mux.Router, blogs *Blogs, users *Users) map[string]string {
+	successors := map[string]string{}
+	handleLegacy := func(path, successor, method string, handler http.HandlerFunc) {
+		successors[path] = successor
+		router.HandleFunc(path, deprecated(successor, handler)).Methods(method)
+	}
+
+	handleLegacy("/signup", "/v1/users", http.MethodPost, users.Signup)
+	handleLegacy("/login", "/v1/sessions", http.MethodPost, users.Login)
+	handleLegacy("/users/{id}/role", "/v1/users/{id}/role", http.MethodPut, users.verifyToken(users.requireRole(RoleAdmin, users.ChangeUserRoleHandler)))
+
+	handleLegacy("/blogs", "/v1/articles", http.MethodGet, users.verifyToken(users.requireRole(RoleReader, blogs.ListAllArticlesHandler)))
+	// articles were published right away before drafts existed, clients of the legacy route still expect it
+	handleLegacy("/blogs/create", "/v1/articles", http.MethodPost, users.verifyToken(users.requireRole(RoleAuthor, blogs.PublishArticleHandler(StatusPublished))))
+	// registered before /blogs/{id}, which would match them otherwise
+	handleLegacy("/blogs/scheduled", "/v1/articles/scheduled", http.MethodGet, users.verifyToken(users.requireRole(RoleAuthor, blogs.ListScheduledArticlesHandler)))
+	handleLegacy("/blogs/trash", "/v1/articles/trash", http.MethodGet, users.verifyToken(users.requireRole(RoleAuthor, blogs.ListTrashHandler)))
+	handleLegacy("/blogs/{id}", "/v1/articles/{id}", http.MethodGet, users.verifyToken(users.requireRole(RoleReader, blogs.ListArticleHandler)))
+	handleLegacy("/blogs/{id}", "/v1/articles/{id}", http.MethodPatch, users.verifyToken(users.requireRole(RoleAuthor, blogs.PatchArticleHandler)))
+	handleLegacy("/blogs/delete/{id}", "/v1/articles/{id}", http.MethodDelete, users.verifyToken(users.requireRole(RoleAuthor, blogs.DeleteArticleHandler)))
+	handleLegacy("/blogs/update/{id}", "/v1/articles/{id}", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.UpdateArticleHandler)))
+	handleLegacy("/blogs/restore/{id}", "/v1/articles/{id}/restore", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.RestoreArticleHandler)))
+	handleLegacy("/blogs/publish/{id}", "/v1/articles/{id}/publish", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusPublished))))
+	handleLegacy("/blogs/unpublish/{id}", "/v1/articles/{id}/unpublish", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusDraft))))
+	handleLegacy("/blogs/archive/{id}", "/v1/articles/{id}/archive", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.ChangeArticleStatusHandler(StatusArchived))))
+	handleLegacy("/blogs/schedule/{id}", "/v1/articles/{id}/schedule", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.ScheduleArticleHandler)))
+	handleLegacy("/blogs/unschedule/{id}", "/v1/articles/{id}/schedule", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.CancelScheduledArticleHandler)))
+	handleLegacy("/blogs/{id}/revisions", "/v1/articles/{id}/revisions", http.MethodGet, users.verifyToken(users.requireRole(RoleAuthor, blogs.ListRevisionsHandler)))
+	// registered before /blogs/{id}/revisions/{revision}, which would match it otherwise
+	handleLegacy("/blogs/{id}/revisions/diff", "/v1/articles/{id}/revisions/diff", http.MethodGet, users.verifyToken(users.requireRole(RoleAuthor, blogs.DiffRevisionsHandler)))
+	handleLegacy("/blogs/{id}/revisions/{revision}", "/v1/articles/{id}/revisions/{revision}", http.MethodGet, users.verifyToken(users.requireRole(RoleAuthor, blogs.GetRevisionHandler)))
+	handleLegacy("/blogs/{id}/revisions/{revision}/restore", "/v1/articles/{id}/revisions/{revision}/restore", http.MethodPut, users.verifyToken(users.requireRole(RoleAuthor, blogs.RestoreRevisionHandler)))
+	return successors
+}
+
+// deprecated marks the responses of a legacy route as deprecated and links to its successor,
+// whose {name} placeholders are filled in from the route variables of the request
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		setDeprecationHeaders(response, successor, mux.Vars(request))
+		next.ServeHTTP(response, request)
+	})
+}
+
+// setDeprecationHeaders sets the Deprecation header and the Link header to successor filled in with vars
+func setDeprecationHeaders(response http.ResponseWriter, successor string, vars map[string]string) {
+	link := successor
+	for name, value := range vars {
+		link = strings.Replace(link, "{"+name+"}", value, -1)
+	}
+	response.Header().Set("Deprecation", "true")
+	response.Header().Set("Link", "<"+link+">; rel=\"successor-version\"")
+}
+
+// methodNotAllowedHandler answers requests whose path is routed for other methods only, listing those inside the Allow header.
+// Requests to a legacy path of legacySuccessors are marked as deprecated like its other responses.
+func methodNotAllowedHandler(router *mux.Router, legacySuccessors map[string]string) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var allowed []string
+		for _, method := range routeMethods {
+			var match mux.RouteMatch
+			probe := request.Clone(request.Context())
+			probe.Method = method
+			if !router.Match(probe, &match) || match.MatchErr != nil {
+				continue
+			}
+			allowed = append(allowed, method)
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				if successor, ok := legacySuccessors[template]; ok {
+					setDeprecationHeaders(response, successor, match.Vars)
+				}
+			}
+		}
+		response.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		statusMessage := Error{
+			Code: CodeMethodNotAllowed,
+		}
+		ExitWithError(response, statusMessage)
+	})
+}
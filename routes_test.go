@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		article := server.createArticle(token, "Legacy", "content")
+
+		recorder := server.do(http.MethodGet, "/blogs/"+article.ID, token, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		if recorder.Header().Get("Deprecation") != "true" {
+			t.Fatalf("expected a Deprecation header, got %v", recorder.Header())
+		}
+
+		// a legacy path requested with a method it is not routed for is deprecated all the same
+		recorder = server.do(http.MethodPost, "/blogs/update/"+article.ID, token, nil)
+		expectProblem(t, recorder, http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+		if recorder.Header().Get("Allow") != http.MethodPut {
+			t.Fatalf("expected Allow: PUT, got %q", recorder.Header().Get("Allow"))
+		}
+		if recorder.Header().Get("Deprecation") != "true" {
+			t.Fatalf("expected a Deprecation header, got %v", recorder.Header())
+		}
+		if link := recorder.Header().Get("Link"); link != `</v1/articles/`+article.ID+`>; rel="successor-version"` {
+			t.Fatalf("unexpected Link header %q", link)
+		}
+
+		recorder = server.do(http.MethodPost, "/v1/articles/"+article.ID, token, nil)
+		expectProblem(t, recorder, http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+		if recorder.Header().Get("Deprecation") != "" {
+			t.Fatal("routes under /v1 must not be deprecated")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrArticleNotDraft is returned when publication is scheduled for an article which is not a draft
+var ErrArticleNotDraft = errors.New("only drafts can be scheduled for publication")
+
+// ErrArticleNotScheduled is returned when cancelling the publication of an article which is not scheduled
+var ErrArticleNotScheduled = errors.New("the article is not scheduled for publication")
+
+// ErrPublishAtInPast is returned when publication is scheduled at a time which already passed
+var ErrPublishAtInPast = errors.New("publish_at must be in the future")
+
+// defaultPublishSchedulerInterval is how often the publish scheduler looks for due drafts unless PUBLISH_SCHEDULER_INTERVAL is set
+const defaultPublishSchedulerInterval = time.Minute
+
+// ScheduleArticleByID schedules an existing draft by ID to be published at publishAt, if identity is its author, an editor or an admin
+func (blogs *Blogs) ScheduleArticleByID(identity *Identity, ID string, publishAt time.Time) error {
+	now := time.Now().UTC()
+	if !publishAt.After(now) {
+		return ErrPublishAtInPast
+	}
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
+			return err
+		}
+		if article.Status != StatusDraft {
+			return ErrArticleNotDraft
+		}
+		publishAt = publishAt.UTC()
+		article.PublishAt = &publishAt
+		article.ModifiedAt = &now
+		return nil
+	})
+}
+
+// CancelScheduledArticleByID cancels the scheduled publication of an existing draft by ID, which stays a draft
+func (blogs *Blogs) CancelScheduledArticleByID(identity *Identity, ID string) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if err := checkCanModify(identity)(article); err != nil {
+			return err
+		}
+		if article.Status != StatusDraft || article.PublishAt == nil {
+			return ErrArticleNotScheduled
+		}
+		now := time.Now().UTC()
+		article.PublishAt = nil
+		article.ModifiedAt = &now
+		return nil
+	})
+}
+
+// listScheduledArticles lists the drafts scheduled for publication which identity may modify
+func (blogs *Blogs) listScheduledArticles(identity *Identity) (*ArticleList, error) {
+	list, err := blogs.store.ListScheduled(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	visible := list.Articles[:0]
+	for _, article := range list.Articles {
+		if identity.canModify(article) {
+			visible = append(visible, article)
+		}
+	}
+	list.Articles = visible
+	return list, nil
+}
+
+// publishDueArticles publishes every draft whose publish_at is not after now
+func (blogs *Blogs) publishDueArticles(ctx context.Context, now time.Time) error {
+	due, err := blogs.store.ListScheduled(ctx, &now)
+	if err != nil {
+		return err
+	}
+	for _, invalid := range due.Invalid {
+		log.Println(invalid)
+	}
+
+	for _, article := range due.Articles {
+		err := blogs.store.Update(ctx, article.ID, func(article *Article) error {
+			// the article may have been published, unpublished or rescheduled since it was listed
+			if article.Status != StatusDraft || article.PublishAt == nil || article.PublishAt.After(now) {
+				return ErrArticleNotScheduled
+			}
+			return article.setStatus(StatusPublished, now)
+		})
+		if err == ErrArticleNotScheduled || err == ErrArticleNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Published scheduled blog post %s\n", article.ID)
+	}
+	return nil
+}
+
+// runPublishScheduler publishes due drafts every interval until ctx is done. Schedules live inside the store,
+// so drafts which became due while the server was down are published by the first run on startup.
+func (blogs *Blogs) runPublishScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := blogs.publishDueArticles(ctx, time.Now().UTC()); err != nil {
+			log.Printf("error publishing scheduled blog posts: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
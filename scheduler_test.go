@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// scheduleDraft creates a draft as the user of token, scheduled to be published at publishAt
+func (server *testServer) scheduleDraft(token, title string, publishAt time.Time) *Article {
+	server.t.Helper()
+	input := map[string]string{"title": title, "content": "content", "status": string(StatusDraft), "publish_at": publishAt.Format(time.RFC3339Nano)}
+	recorder := server.do(http.MethodPost, "/v1/articles", token, input)
+	expectStatus(server.t, recorder, http.StatusCreated)
+	article := &Article{}
+	decodeData(server.t, recorder, article)
+	if article.PublishAt == nil || !article.PublishAt.Equal(publishAt) {
+		server.t.Fatalf("expected a draft scheduled at %v, got %+v", publishAt, article)
+	}
+	return article
+}
+
+// expectArticleStatus fails the test unless the article by ID has the status want
+func expectArticleStatus(t *testing.T, blogs *Blogs, ID string, want ArticleStatus) *Article {
+	t.Helper()
+	article, err := blogs.GetArticleByID(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Status != want {
+		t.Fatalf("expected article %s to be %s, got %s", ID, want, article.Status)
+	}
+	return article
+}
+
+func TestSchedulerPublishesDueDrafts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		now := time.Now().UTC()
+		due := server.scheduleDraft(token, "Due", now.Add(time.Hour))
+		later := server.scheduleDraft(token, "Later", now.Add(3*time.Hour))
+
+		runAt := now.Add(2 * time.Hour)
+		if err := server.blogs.publishDueArticles(context.Background(), runAt); err != nil {
+			t.Fatal(err)
+		}
+		published := expectArticleStatus(t, server.blogs, due.ID, StatusPublished)
+		if published.PublishedAt == nil || !published.PublishedAt.Equal(runAt) {
+			t.Fatalf("expected the draft to be published at %v, got %v", runAt, published.PublishedAt)
+		}
+		expectArticleStatus(t, server.blogs, later.ID, StatusDraft)
+	})
+}
+
+func TestSchedulerCatchesUpOnStartup(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		token := server.login("author@example.com").AccessToken
+		draft := server.scheduleDraft(token, "Missed", time.Now().Add(time.Hour))
+		// the draft became due while the server was down
+		err := server.blogs.store.Update(context.Background(), draft.ID, func(article *Article) error {
+			publishAt := time.Now().UTC().Add(-time.Minute)
+			article.PublishAt = &publishAt
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a restarted server only shares the store, and scans it before waiting for the first tick
+		restarted := initBlogs(server.blogs.store)
+		expectBackgroundJob(t, func(ctx context.Context) {
+			restarted.runPublishScheduler(ctx, time.Hour)
+		}, func() bool {
+			article, err := server.blogs.GetArticleByID(draft.ID)
+			return err == nil && article.Status == StatusPublished
+		})
+	})
+}
+
+func TestListAndCancelScheduledArticles(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		author := server.login("author@example.com").AccessToken
+		other := server.login("other@example.com").AccessToken
+		draft := server.scheduleDraft(author, "Scheduled", time.Now().UTC().Add(time.Hour))
+		server.scheduleDraft(other, "Someone else's", time.Now().UTC().Add(time.Hour))
+
+		recorder := server.do(http.MethodGet, "/v1/articles/scheduled", author, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		var scheduled []*Article
+		decodeData(t, recorder, &scheduled)
+		if len(scheduled) != 1 || scheduled[0].ID != draft.ID {
+			t.Fatalf("expected the author to see only their scheduled draft, got %+v", scheduled)
+		}
+
+		path := "/v1/articles/" + draft.ID + "/schedule"
+		expectProblem(t, server.do(http.MethodDelete, path, other, nil), http.StatusForbidden, CodeNotArticleAuthor)
+		recorder = server.do(http.MethodDelete, path, author, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		cancelled := &Article{}
+		decodeData(t, recorder, cancelled)
+		if cancelled.Status != StatusDraft || cancelled.PublishAt != nil {
+			t.Fatalf("expected an unscheduled draft, got %+v", cancelled)
+		}
+		expectProblem(t, server.do(http.MethodDelete, path, author, nil), http.StatusConflict, CodeArticleStateConflict)
+
+		recorder = server.do(http.MethodGet, "/v1/articles/scheduled", author, nil)
+		scheduled = nil
+		decodeData(t, recorder, &scheduled)
+		if len(scheduled) != 0 {
+			t.Fatalf("expected no scheduled drafts after cancelling, got %+v", scheduled)
+		}
+
+		// a cancelled draft is not published once its former publish_at passed
+		if err := server.blogs.publishDueArticles(context.Background(), time.Now().UTC().Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		expectArticleStatus(t, server.blogs, draft.ID, StatusDraft)
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// jwkSetContentType is the media type of a JSON Web Key Set (RFC 7517)
+const jwkSetContentType = "application/jwk-set+json"
+
+// signingMethodEdDSA signs tokens with Ed25519 keys (RFC 8037), which jwt-go does not implement
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA is registered with jwt-go, so that tokens with the EdDSA alg header can be parsed
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (method *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify checks signature with an ed25519.PublicKey
+func (method *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	decoded, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), decoded) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign signs signingString with an ed25519.PrivateKey
+func (method *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// SigningKey is a key pair tokens are signed with, identified by the kid header of the tokens
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+	// JWK is the public key as published by the JWKS endpoint
+	JWK JSONWebKey
+}
+
+// JSONWebKey is the public part of a signing key in the JWK format (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served by the JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySet holds the keys access tokens are signed and verified with
+type KeySet struct {
+	// signing signs new tokens, it is nil when tokens are signed with hashKey instead
+	signing *SigningKey
+	// keys verify tokens by their kid header, including keys being rotated in or out which sign nothing
+	keys map[string]*SigningKey
+	// hashKey verifies HS256 tokens without a kid header, it is nil unless JWT_HASH_KEY is set
+	hashKey []byte
+	jwks    JSONWebKeySet
+}
+
+// initKeySet loads the comma separated PEM files of paths, the first of them signing new tokens.
+// Without paths, tokens are signed with HS256 and hashKey, which nobody else can verify without holding the secret.
+func initKeySet(paths, hashKey string) (*KeySet, error) {
+	keySet := &KeySet{keys: map[string]*SigningKey{}, jwks: JSONWebKeySet{Keys: []JSONWebKey{}}}
+	if hashKey != "" {
+		keySet.hashKey = []byte(hashKey)
+	}
+
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		pemBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if _, ok := keySet.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%s: the key is listed twice", path)
+		}
+		if keySet.signing == nil {
+			keySet.signing = key
+		}
+		keySet.keys[key.ID] = key
+		keySet.jwks.Keys = append(keySet.jwks.Keys, key.JWK)
+	}
+
+	if keySet.signing == nil && keySet.hashKey == nil {
+		return nil, errors.New("either JWT_SIGNING_KEYS or JWT_HASH_KEY must be set")
+	}
+	return keySet, nil
+}
+
+// parseSigningKey parses a PKCS #8, PKCS #1 or SEC 1 PEM encoded private key.
+// RSA keys sign with RS256, P-256 keys with ES256 and Ed25519 keys with EdDSA.
+func parseSigningKey(pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	var privateKey interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q, expected a private key", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{PrivateKey: privateKey}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if privateKey.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits long")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.PublicKey = &privateKey.PublicKey
+		key.JWK = JSONWebKey{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		if privateKey.Curve != elliptic.P256() {
+			return nil, errors.New("ECDSA keys must use the P-256 curve")
+		}
+		key.Method = jwt.SigningMethodES256
+		key.PublicKey = &privateKey.PublicKey
+		key.JWK = JSONWebKey{
+			KeyType: "EC",
+			Curve:   "P-256",
+			X:       base64.RawURLEncoding.EncodeToString(paddedBytes(privateKey.X, 32)),
+			Y:       base64.RawURLEncoding.EncodeToString(paddedBytes(privateKey.Y, 32)),
+		}
+	case ed25519.PrivateKey:
+		key.Method = SigningMethodEdDSA
+		key.PublicKey = privateKey.Public()
+		key.JWK = JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privateKey)
+	}
+
+	ID, err := jwkThumbprint(key.JWK)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = ID
+	key.JWK.KeyID = ID
+	key.JWK.Use = "sig"
+	key.JWK.Algorithm = key.Method.Alg()
+	return key, nil
+}
+
+// paddedBytes returns the big-endian bytes of value left padded with zeros to size, as JWK requires for EC coordinates
+func paddedBytes(value *big.Int, size int) []byte {
+	bytes := value.Bytes()
+	if len(bytes) >= size {
+		return bytes
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(bytes):], bytes)
+	return padded
+}
+
+// jwkThumbprint returns the JWK thumbprint of a public key (RFC 7638), so that keys need no configured ID
+func jwkThumbprint(jwk JSONWebKey) (string, error) {
+	// the thumbprint hashes the required members only, which encoding/json writes sorted and without whitespace
+	members := map[string]string{"kty": jwk.KeyType}
+	switch jwk.KeyType {
+	case "RSA":
+		members["n"] = jwk.N
+		members["e"] = jwk.E
+	case "EC":
+		members["crv"] = jwk.Curve
+		members["x"] = jwk.X
+		members["y"] = jwk.Y
+	case "OKP":
+		members["crv"] = jwk.Curve
+		members["x"] = jwk.X
+	}
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// sign returns a token holding claims signed with the signing key, or with the hash key when no signing key is loaded
+func (keySet *KeySet) sign(claims jwt.Claims) (string, error) {
+	if keySet.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(keySet.hashKey)
+	}
+	token := jwt.NewWithClaims(keySet.signing.Method, claims)
+	token.Header["kid"] = keySet.signing.ID
+	return token.SignedString(keySet.signing.PrivateKey)
+}
+
+// verificationKey is a jwt.Keyfunc returning the key to verify token with, chosen by its kid header.
+// The alg header must match the algorithm of the key, so that a public key is never used as an HMAC secret.
+func (keySet *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	ID, hasID := token.Header["kid"].(string)
+	if !hasID {
+		if keySet.hashKey == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("the token has no kid header")
+		}
+		return keySet.hashKey, nil
+	}
+	key, ok := keySet.keys[ID]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", ID)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("the key %q does not sign with %s", ID, token.Method.Alg())
+	}
+	return key.PublicKey, nil
+}
+
+// JWKSHandler publishes the public keys tokens are verified with, so that other services can verify them without any secret
+func (users *Users) JWKSHandler(response http.ResponseWriter, request *http.Request) {
+	body, err := encodeJSON(users.keys.jwks, isPrettyRequested(request))
+	if err != nil {
+		statusMessage := Error{
+			Code:   CodeInternalError,
+			Detail: "Failed to encode the key set.",
+		}
+		ExitWithError(response, statusMessage)
+		return
+	}
+	// verifiers may cache the keys for a while, since a new key is published before it signs anything
+	response.Header().Set("Cache-Control", "public, max-age=300")
+	response.Header().Set("Content-Type", jwkSetContentType)
+	response.WriteHeader(http.StatusOK)
+	response.Write(body)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeKeyFile writes privateKey as a PKCS #8 PEM file into a temporary directory and returns its path
+func writeKeyFile(t *testing.T, name string, privateKey interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name+".pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// generateKeyFiles writes an RSA, a P-256 and an Ed25519 key, mapped to the algorithm they sign with
+func generateKeyFiles(t *testing.T) map[string]string {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{
+		"RS256": writeKeyFile(t, "rsa", rsaKey),
+		"ES256": writeKeyFile(t, "ec", ecKey),
+		"EdDSA": writeKeyFile(t, "ed", edKey),
+	}
+}
+
+func TestTokensAreSignedWithTheFirstKey(t *testing.T) {
+	keyFiles := generateKeyFiles(t)
+	for alg, path := range keyFiles {
+		keys, err := initKeySet(path, "")
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		server := newTestServer(t, keys)
+		accessToken := server.login("author@example.com").AccessToken
+
+		token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Method.Alg() != alg || token.Header["kid"] != keys.signing.ID {
+			t.Errorf("expected %s signed by %s, got the header %v", alg, keys.signing.ID, token.Header)
+		}
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles", accessToken, nil), http.StatusOK)
+
+		recorder := server.do(http.MethodGet, "/.well-known/jwks.json", "", nil)
+		expectStatus(t, recorder, http.StatusOK)
+		var jwks JSONWebKeySet
+		if err := json.Unmarshal(recorder.Body.Bytes(), &jwks); err != nil {
+			t.Fatal(err)
+		}
+		if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != keys.signing.ID || jwks.Keys[0].Algorithm != alg {
+			t.Errorf("%s: unexpected key set %+v", alg, jwks)
+		}
+	}
+}
+
+func TestRotatedKeysKeepVerifying(t *testing.T) {
+	keyFiles := generateKeyFiles(t)
+	before, err := initKeySet(keyFiles["ES256"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the new key was moved first, while the old one is kept until its tokens expired
+	after, err := initKeySet(keyFiles["EdDSA"]+","+keyFiles["ES256"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}
+	for _, signer := range []*KeySet{before, after} {
+		signed, err := signer.sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jwt.Parse(signed, after.verificationKey); err != nil {
+			t.Errorf("token signed by %s was rejected: %v", signer.signing.ID, err)
+		}
+	}
+	signed, _ := after.sign(claims)
+	if _, err := jwt.Parse(signed, before.verificationKey); err == nil {
+		t.Error("a key which was not loaded yet must not verify tokens")
+	}
+}
+
+func TestVerificationKeyRejectsMismatchedTokens(t *testing.T) {
+	keyFiles := generateKeyFiles(t)
+	keys, err := initKeySet(keyFiles["RS256"], "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}
+
+	// a public key used as an HMAC secret would let anyone sign tokens
+	publicKey, err := x509.MarshalPKIXPublicKey(keys.signing.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = keys.signing.ID
+	forgedString, err := forged.SignedString(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(forgedString, keys.verificationKey); err == nil || !strings.Contains(err.Error(), "does not sign with HS256") {
+		t.Errorf("expected the alg mismatch to be rejected, got %v", err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unknown.Header["kid"] = "unknown"
+	unknownString, _ := unknown.SignedString([]byte("secret"))
+	if _, err := jwt.Parse(unknownString, keys.verificationKey); err == nil || !strings.Contains(err.Error(), "unknown kid") {
+		t.Errorf("expected the unknown kid to be rejected, got %v", err)
+	}
+
+	// tokens without kid were signed with JWT_HASH_KEY before signing keys were configured
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if _, err := jwt.Parse(legacy, keys.verificationKey); err != nil {
+		t.Errorf("expected the HS256 token without kid to be accepted, got %v", err)
+	}
+	withoutHashKey, err := initKeySet(keyFiles["RS256"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(legacy, withoutHashKey.verificationKey); err == nil {
+		t.Error("expected the HS256 token to be rejected without JWT_HASH_KEY")
+	}
+}
+
+func TestParseSigningKeyRejectsWeakKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, privateKey := range map[string]interface{}{"rsa1024": rsaKey, "p384": ecKey} {
+		if _, err := initKeySet(writeKeyFile(t, name, privateKey), ""); err == nil {
+			t.Errorf("expected the %s key to be rejected", name)
+		}
+	}
+	if _, err := initKeySet("", ""); err == nil {
+		t.Error("expected an error without any key")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// ErrArticleNotFound is returned by an ArticleStore when no article exists with the requested ID
+var ErrArticleNotFound = errors.New("article not found")
+
+// ErrUserNotFound is returned by a UserStore when no user is registered with the requested email or ID
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserAlreadyExists is returned by a UserStore when the email of a new user is already registered
+var ErrUserAlreadyExists = errors.New("a user with this email already exists")
+
+// ErrRefreshTokenNotFound is returned by a TokenStore when no refresh token was issued with the requested ID
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// ErrRefreshTokenReused is returned by a TokenStore along with a refresh token which was already exchanged once
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// ErrRefreshTokenInactive is returned by a TokenStore along with a refresh token which expired or was revoked
+var ErrRefreshTokenInactive = errors.New("refresh token has expired or was revoked")
+
+// ErrUnsupportedQuery is returned by an ArticleStore which cannot run a combination of sorting and filtering
+var ErrUnsupportedQuery = errors.New("this combination of sort and filters is not supported")
+
+// ArticleStore is an interface which abstracts the database holding blog posts
+type ArticleStore interface {
+	// List returns a page of articles, skipping documents which cannot be decoded, or ErrUnsupportedQuery
+	List(ctx context.Context, query ArticleQuery) (*ArticleList, error)
+	// Get returns a single article by ID, ErrArticleNotFound, or a *DocumentError if it cannot be decoded
+	Get(ctx context.Context, ID string) (*Article, error)
+	// Add stores a new article along with its first revision and returns its generated ID
+	Add(ctx context.Context, article *Article) (string, error)
+	// Delete permanently removes an article by ID along with its revisions, or returns ErrArticleNotFound.
+	// check runs on the stored article atomically with the deletion, which is aborted when it returns an error.
+	Delete(ctx context.Context, ID string, check func(article *Article) error) error
+	// Update loads an article by ID, lets update modify it and stores the result atomically.
+	// When the update changed the article, the revisions returned by newRevisions(before, after, latest) are stored with it,
+	// otherwise nothing is written.
+	Update(ctx context.Context, ID string, update func(article *Article) error) error
+	// ListRevisions returns every revision of an article by ID, oldest first
+	ListRevisions(ctx context.Context, ID string) ([]*Revision, error)
+	// GetRevision returns a single revision of an article by ID, or ErrRevisionNotFound
+	GetRevision(ctx context.Context, ID string, number int) (*Revision, error)
+	// ListScheduled returns every draft scheduled to be published, ordered by publish_at, skipping documents which
+	// cannot be decoded. When dueBy is set, only the drafts scheduled at or before dueBy are returned.
+	ListScheduled(ctx context.Context, dueBy *time.Time) (*ArticleList, error)
+	// ListExpiredTrash returns every article moved to the trash before deletedBefore, skipping documents which cannot be decoded
+	ListExpiredTrash(ctx context.Context, deletedBefore time.Time) (*ArticleList, error)
+}
+
+// UserStore is an interface which abstracts the database holding registered users
+type UserStore interface {
+	// AddUser stores a newly registered user, or returns ErrUserAlreadyExists
+	AddUser(ctx context.Context, user *User) error
+	// GetUserByEmail returns a registered user by email, or ErrUserNotFound
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// GetUserByID returns a registered user by generated ID, or ErrUserNotFound
+	GetUserByID(ctx context.Context, ID string) (*User, error)
+	// SetUserRole changes the role of a registered user, or returns ErrUserNotFound
+	SetUserRole(ctx context.Context, ID string, role Role) error
+}
+
+// TokenStore is an interface which abstracts the database holding issued refresh tokens
+type TokenStore interface {
+	// AddRefreshToken stores a newly issued refresh token
+	AddRefreshToken(ctx context.Context, token *RefreshToken) error
+	// UseRefreshToken marks a refresh token by ID as used at usedAt and returns it, or ErrRefreshTokenNotFound.
+	// A token already marked as used is returned along with ErrRefreshTokenReused, and a token which is not active
+	// at usedAt is returned unmarked along with ErrRefreshTokenInactive. Checking and marking must be atomic.
+	UseRefreshToken(ctx context.Context, ID string, usedAt time.Time) (*RefreshToken, error)
+	// RevokeRefreshTokenFamily marks every refresh token of a family which is not revoked yet as revoked at revokedAt
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error
+	// RevokeAccessToken rejects the access tokens revoked by the given ID until expiresAt, after which they are expired anyway
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeUserTokens rejects every access token of a user issued at or before revokedAt until expiresAt,
+	// and marks every refresh token of the user as revoked
+	RevokeUserTokens(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether an access token was revoked by any of tokenIDs, as returned by
+	// Identity.revocationIDs, or along with every token of its user
+	IsAccessTokenRevoked(ctx context.Context, tokenIDs []string, userID string, issuedAt time.Time) (bool, error)
+	// DeleteExpiredRevocations removes the revocations which expired at or before now and returns how many were removed
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error)
+}
+
+const autoIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// newAutoID generates a random 20 character ID in the same format as Firestore auto IDs
+func newAutoID() string {
+	ID := make([]byte, 20)
+	max := big.NewInt(int64(len(autoIDAlphabet)))
+	for i := range ID {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		ID[i] = autoIDAlphabet[n.Int64()]
+	}
+	return string(ID)
+}
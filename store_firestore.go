@@ -0,0 +1,743 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FirestoreArticleStore is an ArticleStore which keeps articles inside the Firestore "blogs" collection
+type FirestoreArticleStore struct {
+	db *firestore.Client
+}
+
+func initFirestoreArticleStore(db *firestore.Client) *FirestoreArticleStore {
+	return &FirestoreArticleStore{db: db}
+}
+
+func (store *FirestoreArticleStore) collection() *firestore.CollectionRef {
+	return store.db.Collection("blogs")
+}
+
+// articleFromDocument decodes a document snapshot of the "blogs" collection into an Article
+func articleFromDocument(doc *firestore.DocumentSnapshot) (*Article, error) {
+	return decodeArticle("blogs", doc.Ref.ID, doc.Data())
+}
+
+// articleFields converts an Article into the fields stored inside its document
+func articleFields(article *Article) map[string]interface{} {
+	fields := map[string]interface{}{
+		"title":      article.Title,
+		"content":    article.Content,
+		"status":     string(article.Status),
+		"version":    article.Version,
+		"created_at": article.CreatedAt,
+		// Firestore cannot filter on a missing field, so whether the article is inside the trash is stored explicitly
+		"trashed": article.DeletedAt != nil,
+	}
+	if article.AuthorID != "" {
+		fields["author_id"] = article.AuthorID
+	}
+	if article.ModifiedAt != nil {
+		fields["modified_at"] = *article.ModifiedAt
+	}
+	if article.PublishedAt != nil {
+		fields["published_at"] = *article.PublishedAt
+	}
+	if article.PublishAt != nil {
+		fields["publish_at"] = *article.PublishAt
+	}
+	if article.DeletedAt != nil {
+		fields["deleted_at"] = *article.DeletedAt
+	}
+	return fields
+}
+
+// changedFields returns the entries of after which differ from before, and deletes the entries missing from after
+func changedFields(before, after map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed[key] = firestore.Delete
+		}
+	}
+	for key, value := range after {
+		if timestamp, ok := value.(time.Time); ok {
+			if previous, ok := before[key].(time.Time); ok && previous.Equal(timestamp) {
+				continue
+			}
+		} else if before[key] == value {
+			continue
+		}
+		changed[key] = value
+	}
+	return changed
+}
+
+// firestoreArticleError converts a NotFound error of the Firestore API into ErrArticleNotFound
+func firestoreArticleError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrArticleNotFound
+	}
+	return err
+}
+
+// List returns a page of documents of the "blogs" collection. It needs migrations 1 to 4, since Firestore
+// orders documents with string timestamps after every document with a native one, and leaves out
+// documents missing the fields it filters or orders by.
+func (store *FirestoreArticleStore) List(ctx context.Context, query ArticleQuery) (*ArticleList, error) {
+	// Firestore requires the field of a range filter to be the first one ordered by
+	isFilteringByCreatedAt := query.CreatedAfter != nil || query.CreatedBefore != nil
+	if isFilteringByCreatedAt && query.Sort != SortByCreatedAt {
+		return nil, ErrUnsupportedQuery
+	}
+
+	direction := firestore.Asc
+	if query.Descending {
+		direction = firestore.Desc
+	}
+	firestoreQuery := store.collection().Where("trashed", "==", query.Trashed)
+	if query.Status != "" {
+		firestoreQuery = firestoreQuery.Where("status", "==", string(query.Status))
+	}
+	if query.AuthorID != "" {
+		firestoreQuery = firestoreQuery.Where("author_id", "==", query.AuthorID)
+	}
+	if query.CreatedAfter != nil {
+		firestoreQuery = firestoreQuery.Where("created_at", ">", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		firestoreQuery = firestoreQuery.Where("created_at", "<", *query.CreatedBefore)
+	}
+	firestoreQuery = firestoreQuery.
+		OrderBy(string(query.Sort), direction).
+		OrderBy(firestore.DocumentID, direction)
+	if query.After != nil {
+		firestoreQuery = firestoreQuery.StartAfter(query.After.value(), query.After.ID)
+	}
+
+	// documents which cannot be decoded do not count towards the limit, so the iterator is stopped once the page is full
+	list, err := readArticles(ctx, firestoreQuery, func(list *ArticleList) bool { return list.isFull(query) })
+	if err != nil {
+		return nil, err
+	}
+	list.finishPage(query)
+	return list, nil
+}
+
+// ListScheduled returns the documents of the "blogs" collection holding drafts scheduled to be published
+func (store *FirestoreArticleStore) ListScheduled(ctx context.Context, dueBy *time.Time) (*ArticleList, error) {
+	// ordering by publish_at leaves out every document without it
+	firestoreQuery := store.collection().Where("status", "==", string(StatusDraft))
+	if dueBy != nil {
+		firestoreQuery = firestoreQuery.Where("publish_at", "<=", *dueBy)
+	}
+	firestoreQuery = firestoreQuery.
+		OrderBy("publish_at", firestore.Asc).
+		OrderBy(firestore.DocumentID, firestore.Asc)
+	return readArticles(ctx, firestoreQuery, func(list *ArticleList) bool { return false })
+}
+
+// ListExpiredTrash returns the documents of the "blogs" collection moved to the trash before deletedBefore
+func (store *FirestoreArticleStore) ListExpiredTrash(ctx context.Context, deletedBefore time.Time) (*ArticleList, error) {
+	firestoreQuery := store.collection().
+		Where("trashed", "==", true).
+		Where("deleted_at", "<", deletedBefore).
+		OrderBy("deleted_at", firestore.Asc)
+	return readArticles(ctx, firestoreQuery, func(list *ArticleList) bool { return false })
+}
+
+// readArticles decodes the documents matched by query until isDone reports the list is complete
+func readArticles(ctx context.Context, query firestore.Query, isDone func(list *ArticleList) bool) (*ArticleList, error) {
+	list := &ArticleList{}
+	docSnapshotIter := query.Documents(ctx)
+	defer docSnapshotIter.Stop()
+	for !isDone(list) {
+		doc, err := docSnapshotIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		article, err := articleFromDocument(doc)
+		if documentErr, ok := err.(*DocumentError); ok {
+			list.Invalid = append(list.Invalid, documentErr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list.Articles = append(list.Articles, article)
+	}
+	return list, nil
+}
+
+// Get returns a single document of the "blogs" collection by ID
+func (store *FirestoreArticleStore) Get(ctx context.Context, ID string) (*Article, error) {
+	docSnapshot, err := store.collection().Doc(ID).Get(ctx)
+	if err != nil {
+		return nil, firestoreArticleError(err)
+	}
+	return articleFromDocument(docSnapshot)
+}
+
+// Add creates a new document with an auto generated ID, along with its first document of the "revisions" subcollection
+func (store *FirestoreArticleStore) Add(ctx context.Context, article *Article) (string, error) {
+	docRef := store.collection().NewDoc()
+	newArticle := *article
+	newArticle.ID = docRef.ID
+
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(docRef, articleFields(&newArticle)); err != nil {
+			return err
+		}
+		return createFirestoreRevisions(tx, docRef, []*Revision{revisionOf(&newArticle, 1)})
+	})
+	if err != nil {
+		return "", err
+	}
+	return docRef.ID, nil
+}
+
+// Delete removes a document by ID along with its "revisions" subcollection inside a transaction, once check accepts it
+func (store *FirestoreArticleStore) Delete(ctx context.Context, ID string, check func(article *Article) error) error {
+	ref := store.collection().Doc(ID)
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnapshot, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		article, err := articleFromDocument(docSnapshot)
+		if err != nil {
+			return err
+		}
+		if err := check(article); err != nil {
+			return err
+		}
+
+		// Firestore keeps subcollections of deleted documents, and a transaction must read everything before writing
+		revisionRefs, err := tx.DocumentRefs(ref.Collection("revisions")).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, revisionRef := range revisionRefs {
+			if err := tx.Delete(revisionRef); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(ref, firestore.Exists)
+	})
+	return firestoreArticleError(err)
+}
+
+// Update runs update inside a transaction and writes back only the fields it changed as a new version, along with new revisions
+func (store *FirestoreArticleStore) Update(ctx context.Context, ID string, update func(article *Article) error) error {
+	ref := store.collection().Doc(ID)
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnapshot, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		before, err := articleFromDocument(docSnapshot)
+		if err != nil {
+			return err
+		}
+		article := *before
+		if err := update(&article); err != nil {
+			return err
+		}
+
+		if article.isUnchangedFrom(before) {
+			return nil
+		}
+		article.Version = before.Version + 1
+		changed := changedFields(articleFields(before), articleFields(&article))
+
+		// a transaction must read everything before writing
+		latest, err := latestFirestoreRevision(tx, ref)
+		if err != nil {
+			return err
+		}
+		if err := tx.Set(ref, changed, firestore.MergeAll); err != nil {
+			return err
+		}
+		return createFirestoreRevisions(tx, ref, newRevisions(before, &article, latest))
+	})
+	return firestoreArticleError(err)
+}
+
+// firestoreRevision is the document of a revision inside the "revisions" subcollection of an article
+type firestoreRevision struct {
+	Number    int       `firestore:"number"`
+	Title     string    `firestore:"title"`
+	Content   string    `firestore:"content"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
+
+// createFirestoreRevisions creates a document per revision inside the "revisions" subcollection of an article
+func createFirestoreRevisions(tx *firestore.Transaction, articleRef *firestore.DocumentRef, revisions []*Revision) error {
+	for _, revision := range revisions {
+		err := tx.Create(articleRef.Collection("revisions").Doc(strconv.Itoa(revision.Number)), firestoreRevision{
+			Number:    revision.Number,
+			Title:     revision.Title,
+			Content:   revision.Content,
+			CreatedAt: revision.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestFirestoreRevision returns the number of the latest revision of an article, or 0 when it has none
+func latestFirestoreRevision(tx *firestore.Transaction, articleRef *firestore.DocumentRef) (int, error) {
+	docs, err := tx.Documents(articleRef.Collection("revisions").OrderBy("number", firestore.Desc).Limit(1)).GetAll()
+	if err != nil || len(docs) == 0 {
+		return 0, err
+	}
+	revision, err := revisionFromDocument(articleRef.ID, docs[0])
+	if err != nil {
+		return 0, err
+	}
+	return revision.Number, nil
+}
+
+func revisionFromDocument(articleID string, doc *firestore.DocumentSnapshot) (*Revision, error) {
+	var stored firestoreRevision
+	if err := doc.DataTo(&stored); err != nil {
+		return nil, fmt.Errorf("revision %s of article %s is invalid: %v", doc.Ref.ID, articleID, err)
+	}
+	return &Revision{
+		ArticleID: articleID,
+		Number:    stored.Number,
+		Title:     stored.Title,
+		Content:   stored.Content,
+		CreatedAt: stored.CreatedAt.UTC(),
+	}, nil
+}
+
+// ListRevisions returns the documents of the "revisions" subcollection of an article by ID
+func (store *FirestoreArticleStore) ListRevisions(ctx context.Context, ID string) ([]*Revision, error) {
+	docs, err := store.collection().Doc(ID).Collection("revisions").OrderBy("number", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	revisions := []*Revision{}
+	for _, doc := range docs {
+		revision, err := revisionFromDocument(ID, doc)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// GetRevision returns a single document of the "revisions" subcollection of an article by ID
+func (store *FirestoreArticleStore) GetRevision(ctx context.Context, ID string, number int) (*Revision, error) {
+	doc, err := store.collection().Doc(ID).Collection("revisions").Doc(strconv.Itoa(number)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return revisionFromDocument(ID, doc)
+}
+
+// AppliedMigrations reads the migrations recorded inside the "schema_migrations" collection
+func (store *FirestoreArticleStore) AppliedMigrations(ctx context.Context) (map[int]AppliedMigration, error) {
+	applied := map[int]AppliedMigration{}
+	docs, err := store.db.Collection("schema_migrations").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var record struct {
+			Version     int       `firestore:"version"`
+			Description string    `firestore:"description"`
+			AppliedAt   time.Time `firestore:"applied_at"`
+		}
+		if err := doc.DataTo(&record); err != nil {
+			return nil, fmt.Errorf("migration record %s is invalid: %v", doc.Ref.ID, err)
+		}
+		applied[record.Version] = AppliedMigration(record)
+	}
+	return applied, nil
+}
+
+// ApplyMigration runs the Firestore part of a migration and records it inside the "schema_migrations" collection
+func (store *FirestoreArticleStore) ApplyMigration(ctx context.Context, migration Migration) error {
+	if migration.Firestore != nil {
+		if err := migration.Firestore(ctx, store.db); err != nil {
+			return err
+		}
+	}
+	_, err := store.db.Collection("schema_migrations").Doc(strconv.Itoa(migration.Version)).Set(ctx, map[string]interface{}{
+		"version":     migration.Version,
+		"description": migration.Description,
+		"applied_at":  time.Now().UTC(),
+	})
+	return err
+}
+
+// FirestoreUserStore is a UserStore which keeps users inside the Firestore "users" collection.
+// Every email is claimed by a document of the "user_emails" collection, whose creation fails once it exists.
+type FirestoreUserStore struct {
+	db *firestore.Client
+}
+
+func initFirestoreUserStore(db *firestore.Client) *FirestoreUserStore {
+	return &FirestoreUserStore{db: db}
+}
+
+// emailClaimRef returns the document of the "user_emails" collection claiming email, which is compared case insensitively.
+// The document ID is a hash, since emails may hold characters which document IDs must not.
+func (store *FirestoreUserStore) emailClaimRef(email string) *firestore.DocumentRef {
+	hash := sha256.Sum256([]byte(strings.ToLower(email)))
+	return store.db.Collection("user_emails").Doc(hex.EncodeToString(hash[:]))
+}
+
+// AddUser creates a new document for the user with an auto generated document ID, along with the claim of its email
+// inside the same transaction, or returns ErrUserAlreadyExists when the email is already claimed
+func (store *FirestoreUserStore) AddUser(ctx context.Context, user *User) error {
+	ref := store.db.Collection("users").NewDoc()
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(store.emailClaimRef(user.Email), emailClaimFields(user)); err != nil {
+			return err
+		}
+		return tx.Create(ref, map[string]interface{}{
+			"id":       user.GeneratedID,
+			"email":    user.Email,
+			"password": user.Password,
+			"role":     string(user.Role),
+		})
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+func emailClaimFields(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"email": user.Email,
+		"id":    user.GeneratedID,
+	}
+}
+
+// claimEmail creates the claim of the email of a user stored before emails were claimed,
+// or returns ErrUserAlreadyExists when the email is already claimed
+func (store *FirestoreUserStore) claimEmail(ctx context.Context, user *User) error {
+	_, err := store.emailClaimRef(user.Email).Create(ctx, emailClaimFields(user))
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+// emailClaimOwner returns the generated ID of the user claiming email, or ErrUserNotFound when it is not claimed
+func (store *FirestoreUserStore) emailClaimOwner(ctx context.Context, email string) (string, error) {
+	claim, err := store.emailClaimRef(email).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	ID, _ := claim.Data()["id"].(string)
+	return ID, nil
+}
+
+// deleteEmailClaim deletes the claim of email, so that it can be claimed again
+func (store *FirestoreUserStore) deleteEmailClaim(ctx context.Context, email string) error {
+	_, err := store.emailClaimRef(email).Delete(ctx)
+	return err
+}
+
+// emailClaims returns the generated ID of the user claiming each email of the "user_emails" collection, keyed by lower case email
+func (store *FirestoreUserStore) emailClaims(ctx context.Context) (map[string]string, error) {
+	docs, err := store.db.Collection("user_emails").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]string{}
+	for _, doc := range docs {
+		email, _ := doc.Data()["email"].(string)
+		ID, _ := doc.Data()["id"].(string)
+		claims[strings.ToLower(email)] = ID
+	}
+	return claims, nil
+}
+
+// allUsers decodes every document of the "users" collection, returning the documents which cannot be decoded apart
+func (store *FirestoreUserStore) allUsers(ctx context.Context) ([]*User, []*DocumentError, error) {
+	docs, err := store.db.Collection("users").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	var users []*User
+	var invalid []*DocumentError
+	for _, doc := range docs {
+		user, err := decodeUser("users", doc.Ref.ID, doc.Data())
+		if documentErr, ok := err.(*DocumentError); ok {
+			invalid = append(invalid, documentErr)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, user)
+	}
+	return users, invalid, nil
+}
+
+// GetUserByEmail looks up the user claiming email, which is compared case insensitively like its claim, falling back
+// to the first document of the "users" collection with the email in lower case for users whose email is not claimed yet.
+// Migration 5 stored the emails of older users in lower case.
+func (store *FirestoreUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ID, err := store.emailClaimOwner(ctx, email)
+	if err == nil {
+		return store.GetUserByID(ctx, ID)
+	}
+	if err != ErrUserNotFound {
+		return nil, err
+	}
+
+	iter := store.db.Collection("users").Where("email", "==", strings.ToLower(email)).Limit(1).Documents(ctx)
+	doc, err := iter.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return decodeUser("users", doc[0].Ref.ID, doc[0].Data())
+}
+
+// userDocumentByID looks up the document of the "users" collection holding the given generated ID
+func (store *FirestoreUserStore) userDocumentByID(ctx context.Context, ID string) (*firestore.DocumentSnapshot, error) {
+	docs, err := store.db.Collection("users").Where("id", "==", ID).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return docs[0], nil
+}
+
+// GetUserByID looks up the document of the "users" collection with the given generated ID
+func (store *FirestoreUserStore) GetUserByID(ctx context.Context, ID string) (*User, error) {
+	doc, err := store.userDocumentByID(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	return decodeUser("users", doc.Ref.ID, doc.Data())
+}
+
+// SetUserRole updates the role field of the user document with the given generated ID
+func (store *FirestoreUserStore) SetUserRole(ctx context.Context, ID string, role Role) error {
+	doc, err := store.userDocumentByID(ctx, ID)
+	if err != nil {
+		return err
+	}
+	_, err = doc.Ref.Update(ctx, []firestore.Update{{Path: "role", Value: string(role)}})
+	return err
+}
+
+// FirestoreTokenStore is a TokenStore which keeps refresh tokens inside the Firestore "refresh_tokens" collection,
+// revoked access tokens inside "revoked_tokens" and revocations of every token of a user inside "user_token_revocations",
+// using the ID of each token or user as its document ID
+type FirestoreTokenStore struct {
+	db *firestore.Client
+}
+
+func initFirestoreTokenStore(db *firestore.Client) *FirestoreTokenStore {
+	return &FirestoreTokenStore{db: db}
+}
+
+func (store *FirestoreTokenStore) collection() *firestore.CollectionRef {
+	return store.db.Collection("refresh_tokens")
+}
+
+// AddRefreshToken creates the document of a new refresh token
+func (store *FirestoreTokenStore) AddRefreshToken(ctx context.Context, token *RefreshToken) error {
+	_, err := store.collection().Doc(token.ID).Create(ctx, map[string]interface{}{
+		"family_id":  token.FamilyID,
+		"user_id":    token.UserID,
+		"created_at": token.CreatedAt,
+		"expires_at": token.ExpiresAt,
+		"used_at":    token.UsedAt,
+		"revoked_at": token.RevokedAt,
+	})
+	return err
+}
+
+// UseRefreshToken sets used_at of a refresh token document inside a transaction, unless it is already set or the token is inactive
+func (store *FirestoreTokenStore) UseRefreshToken(ctx context.Context, ID string, usedAt time.Time) (*RefreshToken, error) {
+	ref := store.collection().Doc(ID)
+	var token *RefreshToken
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnapshot, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		token, err = decodeRefreshToken("refresh_tokens", ID, docSnapshot.Data())
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+		if !token.isActive(usedAt) {
+			return ErrRefreshTokenInactive
+		}
+		token.UsedAt = &usedAt
+		return tx.Update(ref, []firestore.Update{{Path: "used_at", Value: usedAt}})
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err == ErrRefreshTokenReused || err == ErrRefreshTokenInactive {
+		return token, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RevokeRefreshTokenFamily sets revoked_at of every refresh token document of a family
+func (store *FirestoreTokenStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	query := store.collection().Where("family_id", "==", familyID)
+	return updateFirestoreDocuments(ctx, store.db, query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		if doc.Data()["revoked_at"] != nil {
+			return nil, nil
+		}
+		return []firestore.Update{{Path: "revoked_at", Value: revokedAt}}, nil
+	})
+}
+
+// RevokeAccessToken writes the document of a revoked access token
+func (store *FirestoreTokenStore) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := store.db.Collection("revoked_tokens").Doc(tokenID).Set(ctx, map[string]interface{}{
+		"expires_at": expiresAt,
+	})
+	return err
+}
+
+// RevokeUserTokens writes the revocation document of a user inside a transaction, keeping a later revocation,
+// then sets revoked_at of every refresh token document of the user
+func (store *FirestoreTokenStore) RevokeUserTokens(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+	ref := store.db.Collection("user_token_revocations").Doc(userID)
+	err := store.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnapshot, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if docSnapshot.Exists() {
+			previous, ok := docSnapshot.Data()["revoked_at"].(time.Time)
+			if ok && !previous.Before(revokedAt) {
+				return nil
+			}
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"revoked_at": revokedAt,
+			"expires_at": expiresAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	query := store.collection().Where("user_id", "==", userID)
+	return updateFirestoreDocuments(ctx, store.db, query, func(doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		if doc.Data()["revoked_at"] != nil {
+			return nil, nil
+		}
+		return []firestore.Update{{Path: "revoked_at", Value: revokedAt}}, nil
+	})
+}
+
+// IsAccessTokenRevoked looks up the revocation documents of an access token and of its user
+func (store *FirestoreTokenStore) IsAccessTokenRevoked(ctx context.Context, tokenIDs []string, userID string, issuedAt time.Time) (bool, error) {
+	refs := make([]*firestore.DocumentRef, len(tokenIDs))
+	for i, tokenID := range tokenIDs {
+		refs[i] = store.db.Collection("revoked_tokens").Doc(tokenID)
+	}
+	docSnapshots, err := store.db.GetAll(ctx, refs)
+	if err != nil {
+		return false, err
+	}
+	for _, docSnapshot := range docSnapshots {
+		if docSnapshot.Exists() {
+			return true, nil
+		}
+	}
+
+	docSnapshot, err := store.db.Collection("user_token_revocations").Doc(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	decoder := newDocumentDecoder("user_token_revocations", userID, docSnapshot.Data())
+	revokedAt := decoder.requiredTimestamp("revoked_at")
+	if err := decoder.Err(); err != nil {
+		return false, err
+	}
+	return !issuedAt.After(revokedAt), nil
+}
+
+// DeleteExpiredRevocations deletes the documents of "revoked_tokens" and "user_token_revocations" expired at or before now
+func (store *FirestoreTokenStore) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for _, collection := range []string{"revoked_tokens", "user_token_revocations"} {
+		count, err := deleteFirestoreDocuments(ctx, store.db, store.db.Collection(collection).Where("expires_at", "<=", now))
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteFirestoreDocuments deletes every document matched by query in write batches and returns how many were deleted
+func deleteFirestoreDocuments(ctx context.Context, db *firestore.Client, query firestore.Query) (int, error) {
+	// a write batch accepts at most 500 writes
+	const batchSize = 500
+
+	deleted := 0
+	for {
+		refs, err := query.Limit(batchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return deleted, err
+		}
+		if len(refs) == 0 {
+			return deleted, nil
+		}
+		batch := db.Batch()
+		for _, doc := range refs {
+			batch.Delete(doc.Ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return deleted, err
+		}
+		deleted += len(refs)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryArticleStore is an ArticleStore which keeps articles in process memory, meant for local development and tests
+type MemoryArticleStore struct {
+	mutex     sync.RWMutex
+	articles  map[string]Article
+	revisions map[string][]Revision
+}
+
+func initMemoryArticleStore() *MemoryArticleStore {
+	return &MemoryArticleStore{articles: map[string]Article{}, revisions: map[string][]Revision{}}
+}
+
+// List returns a page of copies of the stored articles
+func (store *MemoryArticleStore) List(ctx context.Context, query ArticleQuery) (*ArticleList, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	articles := make([]*Article, 0, len(store.articles))
+	for _, article := range store.articles {
+		article := article
+		if query.matches(&article) {
+			articles = append(articles, &article)
+		}
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return query.compare(query.cursorFor(articles[i]), query.cursorFor(articles[j])) < 0
+	})
+
+	list := &ArticleList{Articles: articles}
+	if len(list.Articles) > query.Limit+1 {
+		list.Articles = list.Articles[:query.Limit+1]
+	}
+	list.finishPage(query)
+	return list, nil
+}
+
+// Get returns a copy of a single article by ID
+func (store *MemoryArticleStore) Get(ctx context.Context, ID string) (*Article, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	article, ok := store.articles[ID]
+	if !ok {
+		return nil, ErrArticleNotFound
+	}
+	return &article, nil
+}
+
+// Add stores a copy of the given article under a newly generated ID
+func (store *MemoryArticleStore) Add(ctx context.Context, article *Article) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	ID := newAutoID()
+	newArticle := *article
+	newArticle.ID = ID
+	store.articles[ID] = newArticle
+	store.revisions[ID] = []Revision{*revisionOf(&newArticle, 1)}
+	return ID, nil
+}
+
+// Delete removes an article by ID once check accepts it
+func (store *MemoryArticleStore) Delete(ctx context.Context, ID string, check func(article *Article) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	article, ok := store.articles[ID]
+	if !ok {
+		return ErrArticleNotFound
+	}
+	if err := check(&article); err != nil {
+		return err
+	}
+	delete(store.articles, ID)
+	delete(store.revisions, ID)
+	return nil
+}
+
+// Update modifies a copy of an article while holding the write lock and stores it as a new version if update changed it
+func (store *MemoryArticleStore) Update(ctx context.Context, ID string, update func(article *Article) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	before, ok := store.articles[ID]
+	if !ok {
+		return ErrArticleNotFound
+	}
+	article := before
+	if err := update(&article); err != nil {
+		return err
+	}
+	if article.isUnchangedFrom(&before) {
+		return nil
+	}
+	article.ID = ID
+	article.Version = before.Version + 1
+	store.articles[ID] = article
+	for _, revision := range newRevisions(&before, &article, len(store.revisions[ID])) {
+		store.revisions[ID] = append(store.revisions[ID], *revision)
+	}
+	return nil
+}
+
+// ListRevisions returns copies of the revisions of an article by ID
+func (store *MemoryArticleStore) ListRevisions(ctx context.Context, ID string) ([]*Revision, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	revisions := make([]*Revision, 0, len(store.revisions[ID]))
+	for _, revision := range store.revisions[ID] {
+		revision := revision
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
+// GetRevision returns a copy of a single revision of an article by ID
+func (store *MemoryArticleStore) GetRevision(ctx context.Context, ID string, number int) (*Revision, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	// revisions are numbered from 1 without gaps
+	revisions := store.revisions[ID]
+	if number < 1 || number > len(revisions) {
+		return nil, ErrRevisionNotFound
+	}
+	revision := revisions[number-1]
+	return &revision, nil
+}
+
+// ListScheduled returns copies of the drafts scheduled to be published
+func (store *MemoryArticleStore) ListScheduled(ctx context.Context, dueBy *time.Time) (*ArticleList, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	list := &ArticleList{}
+	for _, article := range store.articles {
+		article := article
+		if article.Status != StatusDraft || article.PublishAt == nil {
+			continue
+		}
+		if dueBy != nil && article.PublishAt.After(*dueBy) {
+			continue
+		}
+		list.Articles = append(list.Articles, &article)
+	}
+	sort.Slice(list.Articles, func(i, j int) bool {
+		a, b := list.Articles[i], list.Articles[j]
+		if !a.PublishAt.Equal(*b.PublishAt) {
+			return a.PublishAt.Before(*b.PublishAt)
+		}
+		return a.ID < b.ID
+	})
+	return list, nil
+}
+
+// ListExpiredTrash returns copies of the articles moved to the trash before deletedBefore
+func (store *MemoryArticleStore) ListExpiredTrash(ctx context.Context, deletedBefore time.Time) (*ArticleList, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	list := &ArticleList{}
+	for _, article := range store.articles {
+		article := article
+		if article.DeletedAt != nil && article.DeletedAt.Before(deletedBefore) {
+			list.Articles = append(list.Articles, &article)
+		}
+	}
+	return list, nil
+}
+
+// MemoryUserStore is a UserStore which keeps users in process memory, meant for local development and tests
+type MemoryUserStore struct {
+	mutex sync.RWMutex
+	users map[string]User
+}
+
+func initMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: map[string]User{}}
+}
+
+// AddUser stores a copy of the given user, keyed by its email in lower case
+func (store *MemoryUserStore) AddUser(ctx context.Context, user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	email := strings.ToLower(user.Email)
+	if _, ok := store.users[email]; ok {
+		return ErrUserAlreadyExists
+	}
+	store.users[email] = *user
+	return nil
+}
+
+// GetUserByEmail returns a copy of a registered user by email, which is compared case insensitively
+func (store *MemoryUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user, ok := store.users[strings.ToLower(email)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// GetUserByID returns a copy of a registered user by generated ID
+func (store *MemoryUserStore) GetUserByID(ctx context.Context, ID string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, user := range store.users {
+		if user.GeneratedID == ID {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// SetUserRole changes the role of a registered user
+func (store *MemoryUserStore) SetUserRole(ctx context.Context, ID string, role Role) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for email, user := range store.users {
+		if user.GeneratedID == ID {
+			user.Role = role
+			store.users[email] = user
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// MemoryTokenStore is a TokenStore which keeps refresh tokens and revocations in process memory, meant for local development and tests
+type MemoryTokenStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]RefreshToken
+	// revokedTokens holds the expiry of every revoked access token by ID
+	revokedTokens   map[string]time.Time
+	userRevocations map[string]userRevocation
+}
+
+// userRevocation rejects every access token of a user issued at or before RevokedAt
+type userRevocation struct {
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+func initMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens:          map[string]RefreshToken{},
+		revokedTokens:   map[string]time.Time{},
+		userRevocations: map[string]userRevocation{},
+	}
+}
+
+// AddRefreshToken stores a copy of the given refresh token
+func (store *MemoryTokenStore) AddRefreshToken(ctx context.Context, token *RefreshToken) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.tokens[token.ID] = *token
+	return nil
+}
+
+// UseRefreshToken marks a stored refresh token as used unless it is inactive, and returns a copy of it
+func (store *MemoryTokenStore) UseRefreshToken(ctx context.Context, ID string, usedAt time.Time) (*RefreshToken, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	token, ok := store.tokens[ID]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if token.UsedAt != nil {
+		return &token, ErrRefreshTokenReused
+	}
+	if !token.isActive(usedAt) {
+		return &token, ErrRefreshTokenInactive
+	}
+	token.UsedAt = &usedAt
+	store.tokens[ID] = token
+	return &token, nil
+}
+
+// RevokeRefreshTokenFamily marks every stored refresh token of a family as revoked
+func (store *MemoryTokenStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for ID, token := range store.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			store.tokens[ID] = token
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken remembers the ID of a revoked access token
+func (store *MemoryTokenStore) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.revokedTokens[tokenID] = expiresAt
+	return nil
+}
+
+// RevokeUserTokens remembers when every token of a user was revoked and marks their stored refresh tokens as revoked
+func (store *MemoryTokenStore) RevokeUserTokens(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if previous, ok := store.userRevocations[userID]; !ok || previous.RevokedAt.Before(revokedAt) {
+		store.userRevocations[userID] = userRevocation{RevokedAt: revokedAt, ExpiresAt: expiresAt}
+	}
+	for ID, token := range store.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			store.tokens[ID] = token
+		}
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked looks up the revocations of an access token
+func (store *MemoryTokenStore) IsAccessTokenRevoked(ctx context.Context, tokenIDs []string, userID string, issuedAt time.Time) (bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, tokenID := range tokenIDs {
+		if _, ok := store.revokedTokens[tokenID]; ok {
+			return true, nil
+		}
+	}
+	revocation, ok := store.userRevocations[userID]
+	return ok && !issuedAt.After(revocation.RevokedAt), nil
+}
+
+// DeleteExpiredRevocations forgets the revocations which expired at or before now
+func (store *MemoryTokenStore) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	deleted := 0
+	for tokenID, expiresAt := range store.revokedTokens {
+		if !expiresAt.After(now) {
+			delete(store.revokedTokens, tokenID)
+			deleted++
+		}
+	}
+	for userID, revocation := range store.userRevocations {
+		if !revocation.ExpiresAt.After(now) {
+			delete(store.userRevocations, userID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
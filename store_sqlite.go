@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema lists the statements which bring an empty database up to date, one entry per schema version.
+// Entries must never be edited once released, new changes are appended instead.
+var sqliteSchema = []string{
+	`CREATE TABLE blogs (
+		id          TEXT PRIMARY KEY,
+		title       TEXT NOT NULL,
+		content     TEXT NOT NULL,
+		created_at  TEXT NOT NULL,
+		modified_at TEXT
+	);
+	CREATE TABLE users (
+		id       TEXT PRIMARY KEY,
+		email    TEXT NOT NULL UNIQUE,
+		password TEXT NOT NULL
+	);`,
+	`CREATE TABLE schema_migrations (
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at  TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE blogs ADD COLUMN author_id TEXT;`,
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'author';`,
+	`ALTER TABLE blogs ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+	ALTER TABLE blogs ADD COLUMN published_at TEXT;`,
+	`ALTER TABLE blogs ADD COLUMN publish_at TEXT;`,
+	`CREATE TABLE article_revisions (
+		article_id TEXT NOT NULL REFERENCES blogs (id) ON DELETE CASCADE,
+		number     INTEGER NOT NULL,
+		title      TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (article_id, number)
+	);`,
+	`ALTER TABLE blogs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	`ALTER TABLE blogs ADD COLUMN deleted_at TEXT;`,
+	`CREATE TABLE refresh_tokens (
+		id         TEXT PRIMARY KEY,
+		family_id  TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at    TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+	CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);`,
+	`CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id);
+	CREATE TABLE revoked_tokens (
+		id         TEXT PRIMARY KEY,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE user_token_revocations (
+		user_id    TEXT PRIMARY KEY,
+		revoked_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);`,
+	// SQLite cannot change the collation of a column, so the table is copied. Users whose emails only differ
+	// in case fail this version and must be merged by hand first.
+	`CREATE TABLE users_nocase (
+		id       TEXT PRIMARY KEY,
+		email    TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password TEXT NOT NULL,
+		role     TEXT NOT NULL DEFAULT 'author'
+	);
+	INSERT INTO users_nocase (id, email, password, role) SELECT id, email, password, role FROM users;
+	DROP TABLE users;
+	ALTER TABLE users_nocase RENAME TO users;`,
+}
+
+// SQLiteStore is an ArticleStore, UserStore and TokenStore which keeps articles, users, refresh tokens and revocations inside an embedded SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// initSQLiteStore opens the database file at path, creating it if needed, and migrates its schema
+func initSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer only, sharing one connection avoids "database is locked" errors
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if err := store.migrateSchema(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the underlying database
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
+
+// migrateSchema applies every entry of sqliteSchema newer than the version recorded inside the database
+func (store *SQLiteStore) migrateSchema(ctx context.Context) error {
+	var version int
+	if err := store.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(sqliteSchema); version++ {
+		tx, err := store.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteSchema[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating SQLite schema to version %d: %v", version+1, err)
+		}
+		// PRAGMA does not support placeholders
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sqliteScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqliteTimestampLayout is a fixed width layout, so that timestamps stored as text sort chronologically
+const sqliteTimestampLayout = "2006-01-02 15:04:05.000000000-07:00"
+
+// sqliteTimestamp formats a timestamp the way the SQLite driver parses TIMESTAMP columns
+func sqliteTimestamp(timestamp time.Time) string {
+	return timestamp.UTC().Format(sqliteTimestampLayout)
+}
+
+func sqliteNullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func sqliteNullTimestamp(timestamp *time.Time) sql.NullString {
+	if timestamp == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: sqliteTimestamp(*timestamp), Valid: true}
+}
+
+// scanArticle scans a row of sqliteArticleColumns and decodes it like a document,
+// since timestamps hold legacy time.Now().String() text until migration 1 is applied
+func scanArticle(row sqliteScanner) (*Article, error) {
+	var ID string
+	var authorID, title, content, status, version, createdAt, modifiedAt, publishedAt, publishAt, deletedAt interface{}
+	err := row.Scan(&ID, &authorID, &title, &content, &status, &version, &createdAt, &modifiedAt, &publishedAt, &publishAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrArticleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeArticle("blogs", ID, map[string]interface{}{
+		"author_id":    authorID,
+		"title":        title,
+		"content":      content,
+		"status":       status,
+		"version":      version,
+		"created_at":   createdAt,
+		"modified_at":  modifiedAt,
+		"published_at": publishedAt,
+		"publish_at":   publishAt,
+		"deleted_at":   deletedAt,
+	})
+}
+
+const sqliteArticleColumns = "id, author_id, title, content, status, version, created_at, modified_at, published_at, publish_at, deleted_at"
+
+// sqliteSortExpressions maps the fields articles can be ordered by to the expression ordering the blogs table
+var sqliteSortExpressions = map[ArticleSort]string{
+	SortByCreatedAt:  "created_at",
+	SortByModifiedAt: "COALESCE(modified_at, created_at)",
+	SortByTitle:      "title",
+}
+
+// sqliteCursorValue converts the sort field value of a cursor into a query argument
+func sqliteCursorValue(cursor *ArticleCursor) interface{} {
+	if value, ok := cursor.value().(time.Time); ok {
+		return sqliteTimestamp(value)
+	}
+	return cursor.value()
+}
+
+// List returns a page of rows of the blogs table
+func (store *SQLiteStore) List(ctx context.Context, query ArticleQuery) (*ArticleList, error) {
+	sortExpression, ok := sqliteSortExpressions[query.Sort]
+	if !ok {
+		return nil, ErrUnsupportedQuery
+	}
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{"deleted_at IS NULL"}
+	if query.Trashed {
+		conditions = []string{"deleted_at IS NOT NULL"}
+	}
+	var args []interface{}
+	if query.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(query.Status))
+	}
+	if query.AuthorID != "" {
+		conditions = append(conditions, "author_id = ?")
+		args = append(args, query.AuthorID)
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, sqliteTimestamp(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, sqliteTimestamp(*query.CreatedBefore))
+	}
+	if query.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (?, ?)", sortExpression, comparison))
+		args = append(args, sqliteCursorValue(query.After), query.After.ID)
+	}
+
+	statement := "SELECT " + sqliteArticleColumns + " FROM blogs WHERE " + strings.Join(conditions, " AND ")
+	statement += fmt.Sprintf(" ORDER BY %s %s, id %s", sortExpression, direction, direction)
+
+	// rows which cannot be decoded do not count towards the limit, so reading stops once the page is full
+	list, err := store.scanArticles(ctx, func(list *ArticleList) bool { return list.isFull(query) }, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	list.finishPage(query)
+	return list, nil
+}
+
+// ListScheduled returns the rows of the blogs table holding drafts scheduled to be published
+func (store *SQLiteStore) ListScheduled(ctx context.Context, dueBy *time.Time) (*ArticleList, error) {
+	statement := "SELECT " + sqliteArticleColumns + " FROM blogs WHERE status = ? AND publish_at IS NOT NULL AND deleted_at IS NULL"
+	args := []interface{}{string(StatusDraft)}
+	if dueBy != nil {
+		statement += " AND publish_at <= ?"
+		args = append(args, sqliteTimestamp(*dueBy))
+	}
+	statement += " ORDER BY publish_at, id"
+	return store.scanArticles(ctx, func(list *ArticleList) bool { return false }, statement, args...)
+}
+
+// ListExpiredTrash returns the rows of the blogs table moved to the trash before deletedBefore
+func (store *SQLiteStore) ListExpiredTrash(ctx context.Context, deletedBefore time.Time) (*ArticleList, error) {
+	statement := "SELECT " + sqliteArticleColumns + " FROM blogs WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at, id"
+	return store.scanArticles(ctx, func(list *ArticleList) bool { return false }, statement, sqliteTimestamp(deletedBefore))
+}
+
+// scanArticles runs a query selecting sqliteArticleColumns and decodes its rows until isDone reports the list is complete
+func (store *SQLiteStore) scanArticles(ctx context.Context, isDone func(list *ArticleList) bool, statement string, args ...interface{}) (*ArticleList, error) {
+	rows, err := store.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &ArticleList{}
+	for !isDone(list) && rows.Next() {
+		article, err := scanArticle(rows)
+		if documentErr, ok := err.(*DocumentError); ok {
+			list.Invalid = append(list.Invalid, documentErr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list.Articles = append(list.Articles, article)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns a single row of the blogs table by ID
+func (store *SQLiteStore) Get(ctx context.Context, ID string) (*Article, error) {
+	row := store.db.QueryRowContext(ctx, "SELECT "+sqliteArticleColumns+" FROM blogs WHERE id = ?", ID)
+	return scanArticle(row)
+}
+
+// Add inserts a new row into the blogs table with an auto generated ID, and its first row into the article_revisions table
+func (store *SQLiteStore) Add(ctx context.Context, article *Article) (string, error) {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	ID := newAutoID()
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO blogs ("+sqliteArticleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		ID, sqliteNullString(article.AuthorID), article.Title, article.Content, string(article.Status), article.Version,
+		sqliteTimestamp(article.CreatedAt), sqliteNullTimestamp(article.ModifiedAt), sqliteNullTimestamp(article.PublishedAt), sqliteNullTimestamp(article.PublishAt), sqliteNullTimestamp(article.DeletedAt))
+	if err != nil {
+		return "", err
+	}
+
+	newArticle := *article
+	newArticle.ID = ID
+	if err := insertSQLiteRevisions(ctx, tx, []*Revision{revisionOf(&newArticle, 1)}); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return ID, nil
+}
+
+// Delete removes a row of the blogs table by ID inside a transaction, once check accepts it. Its revisions are removed by the foreign key.
+func (store *SQLiteStore) Delete(ctx context.Context, ID string, check func(article *Article) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	article, err := scanArticle(tx.QueryRowContext(ctx, "SELECT "+sqliteArticleColumns+" FROM blogs WHERE id = ?", ID))
+	if err != nil {
+		return err
+	}
+	if err := check(article); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM blogs WHERE id = ?", ID)
+	if err != nil {
+		return err
+	}
+	if err := articleRowsAffected(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update runs update inside a transaction and writes the modified article back as a new version, if update changed it
+func (store *SQLiteStore) Update(ctx context.Context, ID string, update func(article *Article) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanArticle(tx.QueryRowContext(ctx, "SELECT "+sqliteArticleColumns+" FROM blogs WHERE id = ?", ID))
+	if err != nil {
+		return err
+	}
+	article := *before
+	if err := update(&article); err != nil {
+		return err
+	}
+	if article.isUnchangedFrom(before) {
+		return nil
+	}
+	article.Version = before.Version + 1
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE blogs SET author_id = ?, title = ?, content = ?, status = ?, version = ?, created_at = ?, modified_at = ?, published_at = ?, publish_at = ?, deleted_at = ? WHERE id = ?",
+		sqliteNullString(article.AuthorID), article.Title, article.Content, string(article.Status), article.Version,
+		sqliteTimestamp(article.CreatedAt), sqliteNullTimestamp(article.ModifiedAt), sqliteNullTimestamp(article.PublishedAt), sqliteNullTimestamp(article.PublishAt), sqliteNullTimestamp(article.DeletedAt), ID)
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(number), 0) FROM article_revisions WHERE article_id = ?", ID).Scan(&latest); err != nil {
+		return err
+	}
+	if err := insertSQLiteRevisions(ctx, tx, newRevisions(before, &article, latest)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSQLiteRevisions(ctx context.Context, tx *sql.Tx, revisions []*Revision) error {
+	for _, revision := range revisions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO article_revisions ("+sqliteRevisionColumns+") VALUES (?, ?, ?, ?, ?)",
+			revision.ArticleID, revision.Number, revision.Title, revision.Content, sqliteTimestamp(revision.CreatedAt))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const sqliteRevisionColumns = "article_id, number, title, content, created_at"
+
+func scanRevision(row sqliteScanner) (*Revision, error) {
+	var revision Revision
+	err := row.Scan(&revision.ArticleID, &revision.Number, &revision.Title, &revision.Content, &revision.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	revision.CreatedAt = revision.CreatedAt.UTC()
+	return &revision, nil
+}
+
+// ListRevisions returns the rows of the article_revisions table belonging to an article by ID
+func (store *SQLiteStore) ListRevisions(ctx context.Context, ID string) ([]*Revision, error) {
+	rows, err := store.db.QueryContext(ctx, "SELECT "+sqliteRevisionColumns+" FROM article_revisions WHERE article_id = ? ORDER BY number", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns a single row of the article_revisions table
+func (store *SQLiteStore) GetRevision(ctx context.Context, ID string, number int) (*Revision, error) {
+	row := store.db.QueryRowContext(ctx, "SELECT "+sqliteRevisionColumns+" FROM article_revisions WHERE article_id = ? AND number = ?", ID, number)
+	return scanRevision(row)
+}
+
+// AppliedMigrations reads the migrations recorded inside the schema_migrations table
+func (store *SQLiteStore) AppliedMigrations(ctx context.Context) (map[int]AppliedMigration, error) {
+	rows, err := store.db.QueryContext(ctx, "SELECT version, description, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]AppliedMigration{}
+	for rows.Next() {
+		var record AppliedMigration
+		if err := rows.Scan(&record.Version, &record.Description, &record.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[record.Version] = record
+	}
+	return applied, rows.Err()
+}
+
+// ApplyMigration runs the SQLite part of a migration and records it inside the same transaction
+func (store *SQLiteStore) ApplyMigration(ctx context.Context, migration Migration) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if migration.SQLite != nil {
+		if err := migration.SQLite(ctx, tx); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Description, sqliteTimestamp(time.Now()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddUser inserts a new row into the users table
+func (store *SQLiteStore) AddUser(ctx context.Context, user *User) error {
+	_, err := store.db.ExecContext(ctx,
+		"INSERT INTO users (id, email, password, role) VALUES (?, ?, ?, ?)",
+		user.GeneratedID, user.Email, user.Password, string(user.Role))
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+const sqliteUserColumns = "id, email, password, role"
+
+func scanUser(row sqliteScanner) (*User, error) {
+	var ID string
+	var email, password, role interface{}
+	err := row.Scan(&ID, &email, &password, &role)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeUser("users", ID, map[string]interface{}{
+		"id":       ID,
+		"email":    email,
+		"password": password,
+		"role":     role,
+	})
+}
+
+// GetUserByEmail returns a single row of the users table by email, which the email column compares case insensitively
+func (store *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(store.db.QueryRowContext(ctx, "SELECT "+sqliteUserColumns+" FROM users WHERE email = ?", email))
+}
+
+// GetUserByID returns a single row of the users table by generated ID
+func (store *SQLiteStore) GetUserByID(ctx context.Context, ID string) (*User, error) {
+	return scanUser(store.db.QueryRowContext(ctx, "SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", ID))
+}
+
+// SetUserRole updates the role of a row of the users table
+func (store *SQLiteStore) SetUserRole(ctx context.Context, ID string, role Role) error {
+	result, err := store.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", string(role), ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// AddRefreshToken inserts a new row into the refresh_tokens table
+func (store *SQLiteStore) AddRefreshToken(ctx context.Context, token *RefreshToken) error {
+	_, err := store.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens ("+sqliteRefreshTokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.ID, token.FamilyID, token.UserID, sqliteTimestamp(token.CreatedAt), sqliteTimestamp(token.ExpiresAt),
+		sqliteNullTimestamp(token.UsedAt), sqliteNullTimestamp(token.RevokedAt))
+	return err
+}
+
+const sqliteRefreshTokenColumns = "id, family_id, user_id, created_at, expires_at, used_at, revoked_at"
+
+func scanRefreshToken(row sqliteScanner) (*RefreshToken, error) {
+	var token RefreshToken
+	err := row.Scan(&token.ID, &token.FamilyID, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	return &token, nil
+}
+
+// UseRefreshToken sets used_at of a row of the refresh_tokens table inside a transaction, unless it is already set or the token is inactive
+func (store *SQLiteStore) UseRefreshToken(ctx context.Context, ID string, usedAt time.Time) (*RefreshToken, error) {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	token, err := scanRefreshToken(tx.QueryRowContext(ctx, "SELECT "+sqliteRefreshTokenColumns+" FROM refresh_tokens WHERE id = ?", ID))
+	if err != nil {
+		return nil, err
+	}
+	if token.UsedAt != nil {
+		return token, ErrRefreshTokenReused
+	}
+	if !token.isActive(usedAt) {
+		return token, ErrRefreshTokenInactive
+	}
+	token.UsedAt = &usedAt
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ?", sqliteTimestamp(usedAt), ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RevokeRefreshTokenFamily sets revoked_at of every row of the refresh_tokens table belonging to a family
+func (store *SQLiteStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		sqliteTimestamp(revokedAt), familyID)
+	return err
+}
+
+// RevokeAccessToken inserts a row into the revoked_tokens table, unless the token is already revoked
+func (store *SQLiteStore) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := store.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO revoked_tokens (id, expires_at) VALUES (?, ?)",
+		tokenID, sqliteTimestamp(expiresAt))
+	return err
+}
+
+// RevokeUserTokens records the revocation inside the user_token_revocations table and sets revoked_at of
+// every row of the refresh_tokens table belonging to the user, inside a transaction
+func (store *SQLiteStore) RevokeUserTokens(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_token_revocations (user_id, revoked_at, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at = excluded.revoked_at, expires_at = excluded.expires_at
+		WHERE excluded.revoked_at > revoked_at`,
+		userID, sqliteTimestamp(revokedAt), sqliteTimestamp(expiresAt))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		sqliteTimestamp(revokedAt), userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsAccessTokenRevoked looks up the revoked_tokens and user_token_revocations tables
+func (store *SQLiteStore) IsAccessTokenRevoked(ctx context.Context, tokenIDs []string, userID string, issuedAt time.Time) (bool, error) {
+	args := make([]interface{}, 0, len(tokenIDs)+2)
+	for _, tokenID := range tokenIDs {
+		args = append(args, tokenID)
+	}
+	args = append(args, userID, sqliteTimestamp(issuedAt))
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tokenIDs)), ", ")
+
+	var revoked bool
+	err := store.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE id IN (`+placeholders+`))
+		OR EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = ? AND revoked_at >= ?)`,
+		args...).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpiredRevocations deletes the rows of the revoked_tokens and user_token_revocations tables expired at or before now
+func (store *SQLiteStore) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for _, table := range []string{"revoked_tokens", "user_token_revocations"} {
+		result, err := store.db.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at <= ?", sqliteTimestamp(now))
+		if err != nil {
+			return deleted, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(affected)
+	}
+	return deleted, nil
+}
+
+func articleRowsAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrArticleNotFound
+	}
+	return nil
+}
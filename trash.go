@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrArticleNotTrashed is returned when restoring an article which is not inside the trash
+var ErrArticleNotTrashed = errors.New("the article is not inside the trash")
+
+// Defaults used unless TRASH_RETENTION and TRASH_PURGE_INTERVAL are set
+const (
+	// defaultTrashRetention is how long deleted articles stay inside the trash before they are permanently deleted
+	defaultTrashRetention = 30 * 24 * time.Hour
+	// defaultTrashPurgeInterval is how often the trash purger looks for articles past the retention period
+	defaultTrashPurgeInterval = time.Hour
+)
+
+// RestoreArticleByID moves an existing article by ID out of the trash, if identity is its author, an editor or an admin
+func (blogs *Blogs) RestoreArticleByID(identity *Identity, ID string) error {
+	return blogs.store.Update(context.Background(), ID, func(article *Article) error {
+		if article.DeletedAt == nil {
+			return ErrArticleNotTrashed
+		}
+		if !identity.canModify(article) {
+			return ErrNotArticleAuthor
+		}
+		article.DeletedAt = nil
+		return nil
+	})
+}
+
+// purgeExpiredTrash permanently deletes every article moved to the trash before deletedBefore
+func (blogs *Blogs) purgeExpiredTrash(ctx context.Context, deletedBefore time.Time) error {
+	expired, err := blogs.store.ListExpiredTrash(ctx, deletedBefore)
+	if err != nil {
+		return err
+	}
+	for _, invalid := range expired.Invalid {
+		log.Println(invalid)
+	}
+
+	for _, article := range expired.Articles {
+		err := blogs.store.Delete(ctx, article.ID, func(article *Article) error {
+			// the article may have been restored since it was listed
+			if article.DeletedAt == nil || !article.DeletedAt.Before(deletedBefore) {
+				return ErrArticleNotTrashed
+			}
+			return nil
+		})
+		if err == ErrArticleNotTrashed || err == ErrArticleNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Purged blog post %s from the trash\n", article.ID)
+	}
+	return nil
+}
+
+// runTrashPurger permanently deletes the articles kept inside the trash for longer than retention every interval until ctx is done
+func (blogs *Blogs) runTrashPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := blogs.purgeExpiredTrash(ctx, time.Now().UTC().Add(-retention)); err != nil {
+			log.Printf("error purging the trash: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
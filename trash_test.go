@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// listTrash lists the IDs of the articles inside the trash at path, as seen by the user of token
+func (server *testServer) listTrash(path, token string) map[string]bool {
+	server.t.Helper()
+	recorder := server.do(http.MethodGet, path, token, nil)
+	expectStatus(server.t, recorder, http.StatusOK)
+	var articles []*Article
+	decodeData(server.t, recorder, &articles)
+	IDs := map[string]bool{}
+	for _, article := range articles {
+		IDs[article.ID] = true
+	}
+	return IDs
+}
+
+// trashArticle moves the article by ID to the trash as the user of token
+func (server *testServer) trashArticle(token, ID string) {
+	server.t.Helper()
+	expectStatus(server.t, server.do(http.MethodDelete, "/v1/articles/"+ID, token, nil), http.StatusOK)
+}
+
+func TestTrashListsDeletedArticles(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		author := server.login("author@example.com").AccessToken
+		other := server.login("other@example.com").AccessToken
+		published := server.createArticle(author, "Published", "content")
+		recorder := server.do(http.MethodPost, "/v1/articles", author, map[string]string{"title": "Draft", "content": "content"})
+		expectStatus(t, recorder, http.StatusCreated)
+		draft := &Article{}
+		decodeData(t, recorder, draft)
+		kept := server.createArticle(author, "Kept", "content")
+		othersArticle := server.createArticle(other, "Someone else's", "content")
+		for _, trashed := range []*Article{published, draft} {
+			server.trashArticle(author, trashed.ID)
+		}
+		server.trashArticle(other, othersArticle.ID)
+
+		for path, want := range map[string][]string{
+			"/v1/articles/trash":                  {published.ID, draft.ID},
+			"/v1/articles/trash?status=published": {published.ID},
+			"/v1/articles/trash?status=draft":     {draft.ID},
+		} {
+			listed := server.listTrash(path, author)
+			if len(listed) != len(want) {
+				t.Errorf("%s: expected %v, got %v", path, want, listed)
+			}
+			for _, ID := range want {
+				if !listed[ID] {
+					t.Errorf("%s: expected %s to be listed, got %v", path, ID, listed)
+				}
+			}
+		}
+		if listed := server.listTrash("/v1/articles", author); listed[published.ID] || !listed[kept.ID] {
+			t.Errorf("expected trashed articles to be left out of the article list, got %v", listed)
+		}
+
+		admin := server.login("admin@example.com").AccessToken
+		if listed := server.listTrash("/v1/articles/trash?status=published", admin); len(listed) != 2 || !listed[othersArticle.ID] {
+			t.Errorf("expected admins to see the trash of every author, got %v", listed)
+		}
+	})
+}
+
+func TestRestoreArticleFromTrash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		author := server.login("author@example.com").AccessToken
+		other := server.login("other@example.com").AccessToken
+		article := server.createArticle(author, "Restored", "content")
+		path := "/v1/articles/" + article.ID + "/restore"
+
+		expectProblem(t, server.do(http.MethodPost, path, author, nil), http.StatusConflict, CodeArticleStateConflict)
+		server.trashArticle(author, article.ID)
+		expectProblem(t, server.do(http.MethodGet, "/v1/articles/"+article.ID, author, nil), http.StatusNotFound, CodeArticleNotFound)
+		expectProblem(t, server.do(http.MethodPost, path, other, nil), http.StatusForbidden, CodeNotArticleAuthor)
+
+		recorder := server.do(http.MethodPost, path, author, nil)
+		expectStatus(t, recorder, http.StatusOK)
+		expectStatus(t, server.do(http.MethodGet, "/v1/articles/"+article.ID, author, nil), http.StatusOK)
+		if listed := server.listTrash("/v1/articles/trash", author); len(listed) != 0 {
+			t.Fatalf("expected an empty trash after restoring, got %v", listed)
+		}
+	})
+}
+
+func TestPurgeDeletesExpiredTrash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, server *testServer) {
+		ctx := context.Background()
+		token := server.login("author@example.com").AccessToken
+		expired := server.createArticle(token, "Expired", "content")
+		recent := server.createArticle(token, "Recent", "content")
+		kept := server.createArticle(token, "Kept", "content")
+
+		server.trashArticle(token, expired.ID)
+		time.Sleep(time.Millisecond)
+		deletedBefore := time.Now().UTC()
+		time.Sleep(time.Millisecond)
+		server.trashArticle(token, recent.ID)
+
+		if err := server.blogs.purgeExpiredTrash(ctx, deletedBefore); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.blogs.store.Get(ctx, expired.ID); err != ErrArticleNotFound {
+			t.Fatalf("expected the expired article to be deleted, got %v", err)
+		}
+		for _, ID := range []string{recent.ID, kept.ID} {
+			if _, err := server.blogs.store.Get(ctx, ID); err != nil {
+				t.Fatalf("expected article %s to be kept, got %v", ID, err)
+			}
+		}
+		expectProblem(t, server.do(http.MethodPost, "/v1/articles/"+expired.ID+"/restore", token, nil), http.StatusNotFound, CodeArticleNotFound)
+
+		// without retention, the first run of the purger empties the whole trash
+		expectBackgroundJob(t, func(ctx context.Context) {
+			server.blogs.runTrashPurger(ctx, time.Hour, 0)
+		}, func() bool {
+			_, err := server.blogs.store.Get(ctx, recent.ID)
+			return err == ErrArticleNotFound
+		})
+		if _, err := server.blogs.store.Get(ctx, kept.ID); err != nil {
+			t.Fatalf("expected the article outside the trash to be kept, got %v", err)
+		}
+	})
+}